@@ -0,0 +1,263 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+//////////////////// ANSI TERMINAL ////////////////////
+
+// The ANSI backend drives the terminal with escape sequences and stty, so it
+// needs no cgo and the game builds as a static binary with it alone.
+
+func init() {
+	terminals["ansi"] = func() (Terminal, error) { return NewAnsiTerminal(os.Stdin, os.Stdout), nil }
+}
+
+const escapeWait = 50 * time.Millisecond // For the rest of an escape sequence before it is just Esc
+
+type AnsiTerminal struct {
+	screenBuffer
+	in, out *os.File
+	w       *bufio.Writer
+	saved   string // stty settings to restore
+	colour  bool
+	keys    chan byte
+	resized chan os.Signal
+	killed  chan os.Signal
+}
+
+func NewAnsiTerminal(in, out *os.File) *AnsiTerminal {
+	return &AnsiTerminal{in: in, out: out, w: bufio.NewWriter(out)}
+}
+
+// stty runs stty on the terminal, returning what it printed
+func (t *AnsiTerminal) stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = t.in
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func (t *AnsiTerminal) Start() bool {
+	t.saved, _ = t.stty("-g")
+	t.stty("-icanon", "-echo", "min", "1", "time", "0")
+	term := os.Getenv("TERM")
+	t.colour = term != "" && term != "dumb" && os.Getenv("NO_COLOR") == ""
+
+	t.resized = make(chan os.Signal, 1)
+	signal.Notify(t.resized, syscall.SIGWINCH)
+	// Put the terminal back before dying of ^C or a hang up
+	t.killed = make(chan os.Signal, 1)
+	signal.Notify(t.killed, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		sig, ok := <-t.killed
+		if !ok {
+			return
+		}
+		t.restore()
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+	t.keys = make(chan byte, 64)
+	go func() {
+		r := bufio.NewReader(t.in)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				close(t.keys)
+				return
+			}
+			t.keys <- b
+		}
+	}()
+
+	// The alternate screen, without a cursor
+	t.w.WriteString("\x1b[?1049h\x1b[?25l")
+	t.resize()
+	return t.colour
+}
+
+func (t *AnsiTerminal) Stop() {
+	signal.Stop(t.resized)
+	signal.Stop(t.killed)
+	close(t.killed)
+	t.w.Flush()
+	t.restore()
+}
+
+// restore leaves the alternate screen and puts back the stty settings. It
+// writes straight to the terminal so it is safe from the signal handler.
+func (t *AnsiTerminal) restore() {
+	t.out.WriteString("\x1b[0m\x1b[2J\x1b[?25h\x1b[?1049l")
+	if t.saved != "" {
+		t.stty(t.saved)
+	}
+}
+
+// resize asks the terminal its size, it will all be drawn again.
+func (t *AnsiTerminal) resize() {
+	width, height := 80, 24
+	if size, err := t.stty("size"); err == nil {
+		var rows, cols int
+		if n, _ := fmt.Sscan(size, &rows, &cols); n == 2 && rows > 0 && cols > 0 {
+			width, height = cols, rows
+		}
+	}
+	t.screenBuffer.resize(width, height)
+	t.w.WriteString("\x1b[0m\x1b[2J")
+}
+
+// sgr is the escape sequence that sets a style
+func (t *AnsiTerminal) sgr(st Style) string {
+	s := "\x1b[0"
+	if st.bold {
+		s += ";1"
+	}
+	if st.dim {
+		s += ";2"
+	}
+	if st.reverse {
+		s += ";7"
+	}
+	if t.colour && st.fg != defaultColour {
+		s += fmt.Sprintf(";%v", 30+int(st.fg-black))
+	}
+	if t.colour && st.bg != defaultColour {
+		s += fmt.Sprintf(";%v", 40+int(st.bg-black))
+	}
+	return s + "m"
+}
+
+// flush sends the terminal the cells that have changed since the last time.
+func (t *AnsiTerminal) flush() {
+	cx, cy := -1, -1
+	var st Style
+	styled := false
+	t.changes(func(x, y int, c screenCell) {
+		if x != cx || y != cy {
+			fmt.Fprintf(t.w, "\x1b[%v;%vH", y+1, x+1)
+		}
+		if !styled || st != c.st {
+			t.w.WriteString(t.sgr(c.st))
+			st, styled = c.st, true
+		}
+		t.w.WriteRune(c.ch)
+		cx, cy = x+1, y
+	})
+	t.w.Flush()
+}
+
+func (t *AnsiTerminal) Key() int {
+	t.flush()
+	for {
+		select {
+		case <-t.resized:
+			t.resize()
+			return keyResize
+		case b, ok := <-t.keys:
+			if !ok {
+				// Nothing more to read, quit rather than spin
+				return keyHangup
+			}
+			if b == keyEsc {
+				if key := t.escape(); key != 0 {
+					return key
+				}
+				continue
+			}
+			if b < utf8.RuneSelf {
+				return int(b)
+			}
+			return int(t.utf8(b))
+		}
+	}
+}
+
+// next waits a little for the next byte of a sequence, -1 if none comes
+func (t *AnsiTerminal) next() int {
+	select {
+	case b, ok := <-t.keys:
+		if ok {
+			return int(b)
+		}
+	case <-time.After(escapeWait):
+	}
+	return -1
+}
+
+func (t *AnsiTerminal) utf8(first byte) rune {
+	buf := []byte{first}
+	for !utf8.FullRune(buf) {
+		b := t.next()
+		if b < 0 {
+			break
+		}
+		buf = append(buf, byte(b))
+	}
+	r, _ := utf8.DecodeRune(buf)
+	return r
+}
+
+// escape reads the rest of an escape sequence after Esc, returning the key
+// it is or 0 for one with no key code.
+func (t *AnsiTerminal) escape() int {
+	intro := t.next()
+	if intro != '[' && intro != 'O' {
+		return keyEsc
+	}
+	param := ""
+	for {
+		b := t.next()
+		switch {
+		case b < 0:
+			return 0
+		case b >= '0' && b <= '9' || b == ';':
+			param += string(rune(b))
+			continue
+		}
+		return ansiKey(param, b)
+	}
+}
+
+// ansiKey is the key code for a sequence ending with final, as sent by xterm
+// and the terminals that follow it.
+func ansiKey(param string, final int) int {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'E':
+		return keyB2
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch strings.Split(param, ";")[0] {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "5":
+			return keyPPage
+		case "6":
+			return keyNPage
+		}
+	}
+	return 0
+}
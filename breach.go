@@ -0,0 +1,218 @@
+package main
+
+import (
+	"math"
+)
+
+//////////////////// DECOMPRESSION ////////////////////
+
+// A breach doesn't just thin the air out: it roars out into space, dragging
+// the player toward the hole, and emergency bulkheads slam shut to save the
+// rest of the ship. The level has no UI so it keeps what happens as Events
+// for the UI to pass on at the end of the turn.
+
+const (
+	breachDifferential = 3.0 // Air against vacuum that roars out through a breach
+	bulkheadRange      = 8   // Squares through the air a breach shuts bulkheads
+	pushDifferential   = 2.0 // Difference to a neighbouring square that drags the player
+	hearingRange       = 10  // Squares away a breach or bulkhead can be heard
+	quietAir           = 1.0 // Too little air around the player to carry sound
+)
+
+// An Event is something that happened on the level this turn. Sounds are
+// only heard nearby and with air around the player to carry them.
+type Event struct {
+	x, y  int
+	kind  int // Message kind, e.g. dangerMessage
+	sound bool
+	text  string
+}
+
+// Event notes something that happened at x, y this turn.
+func (level *Level) Event(x, y, kind int, sound bool, text string) {
+	level.events = append(level.events, Event{x, y, kind, sound, text})
+}
+
+// TakeEvents returns the events since it was last called.
+func (level *Level) TakeEvents() []Event {
+	events := level.events
+	level.events = nil
+	return events
+}
+
+// leaking reports whether the air at x, y is escaping into space with at
+// least limit behind it. The hole itself never holds much air so what is
+// behind it is the most next to it that isn't space.
+func (level *Level) leaking(x, y int, limit float64) bool {
+	c := level.cells[x][y]
+	if _, space := c.(*Vacuum); space || !c.AirFlows() {
+		return false
+	}
+	open, behind := false, level.air.air[x][y]
+	for i := x - 1; i <= x+1; i++ {
+		for j := y - 1; j <= y+1; j++ {
+			if i < 0 || i >= level.x || j < 0 || j >= level.y || !level.cells[i][j].AirFlows() {
+				continue
+			}
+			if _, space := level.cells[i][j].(*Vacuum); space {
+				open = true
+			} else if level.air.air[i][j] > behind {
+				behind = level.air.air[i][j]
+			}
+		}
+	}
+	return open && behind >= limit
+}
+
+// decompress warns of breaches as they open and slams shut the bulkheads
+// near any breach. The first turn only notes the breaches that are already
+// there, so a loaded game doesn't start out hissing.
+func (level *Level) decompress() {
+	first := level.breached == nil
+	if first {
+		level.breached = make([][]bool, level.x)
+		for i := range level.breached {
+			level.breached[i] = make([]bool, level.y)
+		}
+	}
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			// Once roaring a breach keeps on until the air is well down
+			limit := breachDifferential
+			if level.breached[i][j] {
+				limit /= 2
+			}
+			breach := level.leaking(i, j, limit)
+			if breach && !level.breached[i][j] && !first {
+				Dlog.Println("   decompress: breach at", i, j)
+				level.Event(i, j, dangerMessage, true, "You hear the hiss of air escaping through a breach")
+			}
+			level.breached[i][j] = breach
+		}
+	}
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if level.breached[i][j] {
+				level.sealOff(i, j)
+			}
+		}
+	}
+}
+
+// sealOff shuts the bulkheads the air reaches within bulkheadRange of the
+// breach at x, y, unless they are held or jammed open.
+func (level *Level) sealOff(x, y int) {
+	dist := map[[2]int]int{{x, y}: 0}
+	todo := [][2]int{{x, y}}
+	for len(todo) > 0 {
+		c := todo[0]
+		todo = todo[1:]
+		if b, ok := level.cells[c[0]][c[1]].(*Bulkhead); ok {
+			if b.open && !b.held && !b.damaged {
+				Dlog.Println("   decompress: bulkhead shut at", c[0], c[1])
+				b.open = false
+				level.Event(c[0], c[1], dangerMessage, true, "You hear an emergency bulkhead slam shut")
+			}
+			continue // The air stops here, or it is open for good
+		}
+		if dist[c] == bulkheadRange {
+			continue
+		}
+		for i := c[0] - 1; i <= c[0]+1; i++ {
+			for j := c[1] - 1; j <= c[1]+1; j++ {
+				n := [2]int{i, j}
+				if _, seen := dist[n]; seen || i < 0 || i >= level.x || j < 0 || j >= level.y {
+					continue
+				}
+				if _, space := level.cells[i][j].(*Vacuum); space || !level.cells[i][j].AirFlows() {
+					continue
+				}
+				dist[n] = dist[c] + 1
+				todo = append(todo, n)
+			}
+		}
+	}
+}
+
+// decompress drags the player a square toward a breach next to them, and
+// out of the way of a bulkhead or door that has shut on them.
+func (p *Player) decompress(level *Level) {
+	if shut := level.cells[p.x][p.y]; !shut.Walkable() {
+		// Stand where there is the most air
+		if x, y, ok := p.neighbour(level, func(x, y int) float64 { return level.air.air[x][y] }); ok {
+			p.Move(x, y)
+			if _, ok := shut.(*Bulkhead); ok {
+				level.Event(x, y, dangerMessage, false, "The bulkhead slams shut and throws you clear")
+			} else {
+				level.Event(x, y, infoMessage, false, "The door shuts and pushes you out of its way")
+			}
+		}
+		return
+	}
+	// The air rushes out from the most around the player to the least
+	breached, behind := false, level.air.air[p.x][p.y]
+	for i := p.x - 1; i <= p.x+1; i++ {
+		for j := p.y - 1; j <= p.y+1; j++ {
+			if i >= 0 && i < level.x && j >= 0 && j < level.y && level.cells[i][j].AirFlows() {
+				breached = breached || level.breached != nil && level.breached[i][j]
+				behind = math.Max(behind, level.air.air[i][j])
+			}
+		}
+	}
+	if !breached {
+		return
+	}
+	x, y, ok := p.neighbour(level, func(x, y int) float64 {
+		if !level.cells[x][y].AirFlows() {
+			return -1
+		}
+		return behind - level.air.air[x][y]
+	})
+	if ok && behind-level.air.air[x][y] >= pushDifferential {
+		p.Move(x, y)
+		level.Event(x, y, dangerMessage, false, "The rushing air drags you toward the breach!")
+	}
+}
+
+// neighbour picks the walkable square next to the player that scores the
+// most, ok is false if there isn't one.
+func (p *Player) neighbour(level *Level, score func(x, y int) float64) (x, y int, ok bool) {
+	best := 0.0
+	for i := p.x - 1; i <= p.x+1; i++ {
+		for j := p.y - 1; j <= p.y+1; j++ {
+			if i < 0 || i >= level.x || j < 0 || j >= level.y || (i == p.x && j == p.y) ||
+				!level.cells[i][j].Walkable() {
+				continue
+			}
+			if v := score(i, j); !ok || v > best {
+				best, x, y, ok = v, i, j, true
+			}
+		}
+	}
+	return x, y, ok
+}
+
+// Hears reports whether the player can hear something at x, y.
+func (p *Player) Hears(level *Level, x, y int) bool {
+	dx, dy := x-p.x, y-p.y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx <= hearingRange && dy <= hearingRange && level.air.air[p.x][p.y] >= quietAir
+}
+
+// tellEvents passes on this turn's events that the player notices, each
+// once however many times it happened.
+func tellEvents(ui UI, level *Level, p *Player) {
+	told := make(map[string]bool)
+	for _, e := range level.TakeEvents() {
+		if told[e.text] || (e.sound && !p.Hears(level, e.x, e.y)) {
+			continue
+		}
+		told[e.text] = true
+		ui.Notify(e.kind, e.text)
+	}
+}
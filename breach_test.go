@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// corridor is a sealed 9x3 corridor full of air, with space to its west
+// beyond the hull at 1,1 and a bulkhead at 4,1, and the player at 3,1.
+func corridor() (*Level, *Player, *HeadlessUI) {
+	level := new(Level)
+	level.x, level.y = 9, 3
+	level.Init()
+	level.rng = NewRNG(1)
+	for i := 1; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if i == 1 || j != 1 || i == level.x-1 {
+				level.cells[i][j] = new(Wall)
+			} else {
+				level.cells[i][j] = new(Floor)
+				level.air.air[i][j] = 9
+			}
+		}
+	}
+	level.cells[4][1] = &Bulkhead{open: true}
+	level.air.air[4][1] = 9
+	level.Iterate()
+	player := new(Player)
+	player.Init()
+	player.x, player.y = 3, 1
+	return level, player, NewHeadlessUI(level, player)
+}
+
+// turns runs n turns, passing on what happened
+func turns(level *Level, player *Player, ui *HeadlessUI, n int) {
+	for i := 0; i < n; i++ {
+		level.Iterate()
+		player.Iterate(level)
+		tellEvents(ui, level, player)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	// Nothing happens in a sealed ship
+	level, player, ui := corridor()
+	turns(level, player, ui, 20)
+	if !(player.x == 3 && len(ui.messages) == 0) {
+		t.Errorf("sealed corridor moved the player to %v or said %v", player.x, ui.messages)
+	}
+
+	// A hole in the hull is heard and shuts the bulkhead, the player is too
+	// far away to be dragged
+	level.cells[1][1] = &Wall{damaged: true}
+	turns(level, player, ui, 1)
+	if !strings.Contains(strings.Join(ui.messages, "\n"), "hiss") {
+		t.Errorf("breach not heard, %v", ui.messages)
+	}
+	if level.cells[4][1].(*Bulkhead).open {
+		t.Errorf("bulkhead did not shut on the breach")
+	}
+	said := len(ui.messages)
+	turns(level, player, ui, 1)
+	if len(ui.messages) != said {
+		t.Errorf("breach heard again, %v", ui.messages[said:])
+	}
+	turns(level, player, ui, 100)
+	if player.x != 3 {
+		t.Errorf("dragged to %v", player.x)
+	}
+
+	// Opened to space the air drags the player out, and the bulkhead saves
+	// the rest of the corridor
+	level, player, ui = corridor()
+	player.x = 2
+	level.cells[1][1] = &Door{open: true}
+	for i := 0; i < 10 && player.x > 0; i++ {
+		turns(level, player, ui, 1)
+	}
+	if player.x != 0 {
+		t.Errorf("player only dragged to %v, %v", player.x, ui.messages)
+	}
+	if !strings.Contains(strings.Join(ui.messages, "\n"), "drags you") {
+		t.Errorf("no warning, %v", ui.messages)
+	}
+	turns(level, player, ui, 10)
+	if level.cells[4][1].(*Bulkhead).open {
+		t.Errorf("bulkhead did not shut")
+	}
+	if level.air.air[6][1] <= 8 {
+		t.Errorf("bulkhead let the air out, %v left", level.air.air[6][1])
+	}
+
+	// Nothing to carry sound in space
+	said = len(ui.messages)
+	level.cells[7][1] = &Wall{damaged: true}
+	level.cells[8][1] = new(Vacuum)
+	turns(level, player, ui, 1)
+	if len(ui.messages) != said {
+		t.Errorf("heard in space, %v", ui.messages[said:])
+	}
+
+	// A door opened between two sealed rooms is no breach
+	level, player, ui = corridor()
+	player.x = 5
+	level.cells[6][1] = new(Door)
+	level.air.air[6][1], level.air.air[7][1] = 0, 0
+	level.cells[6][1].(*Door).open = true
+	turns(level, player, ui, 20)
+	if player.x != 5 || !level.cells[4][1].(*Bulkhead).open || len(ui.messages) != 0 {
+		t.Errorf("opening a door moved the player to %v, bulkhead open %v, said %v",
+			player.x, level.cells[4][1].(*Bulkhead).open, ui.messages)
+	}
+
+	// A damaged bulkhead is jammed open and one opened by hand held open,
+	// one shutting on the player throws them clear
+	for _, b := range []*Bulkhead{{open: true, damaged: true}, {open: true, held: true}} {
+		level, player, ui = corridor()
+		level.cells[4][1] = b
+		level.cells[1][1] = &Door{open: true}
+		turns(level, player, ui, 20)
+		if !b.open {
+			t.Errorf("bulkhead %+v shut", *b)
+		}
+	}
+	level, player, ui = corridor()
+	player.x = 4
+	level.cells[4][1].(*Bulkhead).open = false
+	turns(level, player, ui, 1)
+	if !(player.x != 4 && level.cells[player.x][player.y].Walkable()) {
+		t.Errorf("left inside a bulkhead")
+	}
+	if !(len(ui.messages) == 1 && strings.Contains(ui.messages[0], "bulkhead")) {
+		t.Errorf("thrown out of a bulkhead saying %v", ui.messages)
+	}
+	for _, door := range []Cell{new(Door), new(DoorConduit)} {
+		level, player, ui = corridor()
+		player.x = 5
+		level.cells[5][1] = door
+		turns(level, player, ui, 1)
+		if !(player.x != 5 && len(ui.messages) == 1 && strings.Contains(ui.messages[0], "door shuts")) {
+			t.Errorf("%v shut on the player at %v saying %v", kind(door), player.x, ui.messages)
+		}
+	}
+
+	// Dragged away from a job pauses it
+	level, player, ui = corridor()
+	ui.Script(DirectionAnswer(1, 0))
+	player.Action(level, ui, SALVAGE)
+	player.x = 1
+	player.Work(level, ui, player.Watch(level))
+	if !(!player.Working() && player.job != nil && player.job.done == 0) {
+		t.Errorf("worked out of reach")
+	}
+
+	// A generated ship never drags the player about while it fills up
+	level = GenerateLevel(NewRNG(1), 69, 23, 0.15)
+	player = new(Player)
+	player.Init()
+	player.x, player.y = level.exit_x, level.exit_y
+	bulkheads := 0
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if _, ok := level.cells[i][j].(*Bulkhead); ok {
+				bulkheads++
+			}
+		}
+	}
+	if bulkheads <= 0 {
+		t.Errorf("generated ship has no bulkheads")
+	}
+	for i := 0; i < 300; i++ {
+		level.Iterate()
+		player.Iterate(level)
+		level.TakeEvents()
+	}
+	if !(player.x == level.exit_x && player.y == level.exit_y) {
+		t.Errorf("player at the exit moved to %v, %v", player.x, player.y)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+////////////////////// CAMPAIGN /////////////////////////
+
+// A campaign is the player's run of derelicts, each bigger and more damaged
+// than the last, until they die or head home.
+
+const (
+	baseWidth, baseHeight = 69, 23
+	growWidth, growHeight = 12, 4 // Added each stage
+	maxWidth, maxHeight   = 200, 60
+	baseDamage            = 0.15
+	growDamage            = 0.05
+	maxDamage             = 0.6
+)
+
+// derelictFor gives the size and damage of the derelict at a campaign stage,
+// counting from 1.
+func derelictFor(stage int) (x, y int, damage float64) {
+	x = baseWidth + growWidth*(stage-1)
+	if x > maxWidth {
+		x = maxWidth
+	}
+	y = baseHeight + growHeight*(stage-1)
+	if y > maxHeight {
+		y = maxHeight
+	}
+	damage = math.Min(maxDamage, baseDamage+growDamage*float64(stage-1))
+	return
+}
+
+// RunRecord is what the player made of one derelict.
+type RunRecord struct {
+	score             int
+	steel, copper     int
+	repaired, created int
+	turns             int
+}
+
+func (p *Player) stage() int { return len(p.career) + 1 }
+
+// recordRun adds the derelict the player just left to their career.
+func (p *Player) recordRun(score int) {
+	p.career = append(p.career, RunRecord{score,
+		p.stats.steel, p.stats.copper, p.stats.repaired, p.stats.created, p.stats.turns})
+}
+
+// CampaignSummary describes the whole campaign once it is over.
+func CampaignSummary(player *Player) []string {
+	var lines []string
+	if player.dead {
+		lines = append(lines, fmt.Sprintf("You died aboard derelict %v", player.stage()))
+	} else {
+		lines = append(lines, fmt.Sprintf("You head home after %v derelicts", len(player.career)))
+	}
+	lines = append(lines, "")
+
+	total := 0
+	for i, r := range player.career {
+		total += r.score
+		lines = append(lines, fmt.Sprintf("%2v. score %5v  St:%-4v Cu:%-4v repaired %-3v created %-3v in %v turns",
+			i+1, r.score, r.steel, r.copper, r.repaired, r.created, r.turns))
+	}
+	lines = append(lines, "", fmt.Sprintf("Campaign score: %v", total))
+
+	if len(player.upgrades) > 0 {
+		lines = append(lines, "", "Upgrades fitted:")
+		for _, u := range shipyardStock {
+			if n := player.upgrades[u.id]; n > 0 {
+				lines = append(lines, fmt.Sprintf("  %v x%v", u.name, n))
+			}
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("Left with %v steel and %v copper", player.steel, player.copper))
+	return lines
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCampaign(t *testing.T) {
+	x, y, damage := derelictFor(1)
+	for stage := 2; stage < 5; stage++ {
+		nx, ny, nd := derelictFor(stage)
+		if !(nx >= x && ny >= y && nd > damage) {
+			t.Errorf("stage %v is no harder", stage)
+		}
+		x, y, damage = nx, ny, nd
+	}
+	x, y, damage = derelictFor(1000)
+	if !(x == maxWidth && y == maxHeight && damage == maxDamage) {
+		t.Errorf("stage 1000 is %vx%v %v", x, y, damage)
+	}
+
+	// The career survives a save and load
+	level, player, ui := testBench(new(Floor))
+	player.stats.steel = 7
+	player.recordRun(42)
+	var buf bytes.Buffer
+	memory := Memory{mapCache: [][]int32{make([]int32, 1), make([]int32, 1)}, seen: [][]bool{make([]bool, 1), make([]bool, 1)}}
+	if err := SaveGame(&buf, level, player, memory); err != nil {
+		t.Fatal(err)
+	}
+	_, loaded, _, err := LoadGame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(loaded.career) == 1 && loaded.career[0] == player.career[0]) {
+		t.Errorf("career loaded as %v", loaded.career)
+	}
+
+	// Heading home and dying both end with a summary
+	game := Game{level: *level, player: *player, ui: ui, rng: level.rng}
+	game.player.escaped = true
+	ui.Script(MenuAnswer(len(shipyardStock) + 2))
+	game.Play()
+	if !(len(ui.reports) == 1 && strings.Contains(ui.reports[0][1], "head home after 1")) {
+		t.Errorf("heading home reported %v", ui.reports)
+	}
+	game.player.escaped, game.player.dead = false, true
+	game.Play()
+	if !(len(ui.reports) == 2 && strings.Contains(ui.reports[1][1], "died aboard derelict 2")) {
+		t.Errorf("dying reported %v", ui.reports)
+	}
+}
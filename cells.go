@@ -2,7 +2,8 @@ package main
 
 import (
 	"fmt"
-	"math/rand"
+	"math"
+	"strings"
 )
 
 ////////////////////// CELLS /////////////////////////
@@ -13,129 +14,152 @@ type Cell interface {
 
 	// Air
 	AirFlows() bool
-	AirSinkSource(float64) float64 // Each cell can adjust its amount of air
+	AirSinkSource(float64) float64 // Air added (negative: removed) given the air present
 	// Energy
 	EnergyFlows() bool
-	EnergySinkSource(float64) float64 // Each cell can adjust its amount of energy
+	EnergySupply() float64  // Energy put into the cell's network each turn
+	EnergyDemand() float64  // Energy wanted from the cell's network each turn
+	EnergySupplied(float64) // Energy the network actually delivered this turn
 
 	// Returns are turns, replacement Cell
-	Salvage(UI, *Player) (int, Cell)
-	Repair(UI, *Player) (int, Cell)
-	Create(UI, *Player) int
+	Salvage(UI, *Player, *RNG) (int, Cell)
+	Repair(UI, *Player, *RNG) (int, Cell)
+	Create(UI, *Player, *RNG) int
 
 	Activate(UI) int
+
+	// Construction rules, each returns why not or "" if allowed
+	BuildsOn(under Cell) string  // Can this cell be created over under
+	ReplacedBy(over Cell) string // Can over be created in place of this cell
+}
+
+// Cells that can be broken and repaired
+type Damageable interface {
+	Damaged() bool
 }
 
 ////////////// GENERIC ////////////////////
-func genericSalvage(max_steel, max_copper, max_turns int, ui UI, p *Player) (turns int) {
-	var st, cu int = 0, 0
-	if max_steel > 0 {
-		st = rand.Intn(max_steel)
-	}
-	if max_copper > 0 {
-		cu = rand.Intn(max_copper)
-	}
-	turns = 1 + rand.Intn(max_turns-1)
-
-	p.steel += st
-	p.copper += cu
-	if st == 0 && cu == 0 {
-		ui.Message(fmt.Sprintf("You fail to salvage any useful metals", turns))
-	} else if cu == 0 {
-		ui.Message(fmt.Sprintf("You salvage %v steel in %v turns", st, turns))
-	} else if st == 0 {
-		ui.Message(fmt.Sprintf("You salvage %v copper in %v turns", cu, turns))
-	} else {
-		ui.Message(fmt.Sprintf("You salvage %v steel and %v copper in %v turns", st, cu, turns))
+
+// canBuild returns why over cannot be created in place of under, or "" if it
+// can. The cell already there has the first say.
+func canBuild(over, under Cell) string {
+	if why := under.ReplacedBy(over); why != "" {
+		return why
+	}
+	return over.BuildsOn(under)
+}
+
+// Common construction rules
+func onOpenSpace(under Cell) string {
+	switch under.(type) {
+	case *Vacuum, *Floor:
+		return ""
+	}
+	return "That can only be built on open floor or vacuum"
+}
+func cannotBuild() string { return "That cannot be built" }
+func mustSalvage(name string) string {
+	return fmt.Sprintf("The %v is in the way, salvage it first", name)
+}
+
+// The generic actions roll what the work will take and yield, and plan it as
+// a job for the player, see Work. Nothing changes until the job is finished.
+// Cost is roughly what a job takes: the steel and copper salvage gains or
+// repairs and creation use are rolled below steel and copper, the turns from
+// 1 to below turns.
+type Cost struct {
+	steel, copper, turns int
+}
+
+func (c Cost) String() string {
+	var parts []string
+	if c.steel > 0 {
+		parts = append(parts, fmt.Sprintf("0-%v steel", c.steel-1))
+	}
+	if c.copper > 0 {
+		parts = append(parts, fmt.Sprintf("0-%v copper", c.copper-1))
 	}
+	return strings.Join(append(parts, fmt.Sprintf("1-%v turns", c.turns-1)), ", ")
+}
+
+// roll picks the materials and turns for a job
+func (c Cost) roll(rng *RNG) (st, cu, turns int) {
+	if c.steel > 0 {
+		st = rng.Intn(c.steel)
+	}
+	if c.copper > 0 {
+		cu = rng.Intn(c.copper)
+	}
+	turns = 1 + rng.Intn(c.turns-1)
 	return
 }
-func genericRepair(damaged *bool, max_steel, max_copper, max_turns int, name string, ui UI, p *Player) (turns int) {
+
+// Costed cells can say what salvaging and repairing them takes, a zero
+// Cost for something they cannot have done.
+type Costed interface {
+	SalvageCost() Cost
+	RepairCost() Cost
+}
+
+func genericSalvage(cost Cost, name string, ui UI, p *Player, rng *RNG) (turns int) {
+	st, cu, turns := cost.roll(rng)
+	p.plan(Work{SALVAGE, st, cu, name})
+	return
+}
+func genericRepair(damaged bool, cost Cost, name string, ui UI, p *Player, rng *RNG) (turns int) {
 	turns = 1 // Inpecting the "name" takes at least 1 turn
 
-	if *damaged {
-		var st, cu int = 0, 0
-		if max_steel > 0 {
-			st = rand.Intn(max_steel)
-		}
-		if max_copper > 0 {
-			cu = rand.Intn(max_copper)
-		}
-		p.steel -= st
-		p.copper -= cu
-		turns = 1 + rand.Intn(max_turns-1)
-		if p.steel < 0 && p.copper < 0 {
-			ui.Message(fmt.Sprintf("You run out of steel and copper after %v turns", turns))
-			p.steel = 0
-			p.copper = 0
-		} else if p.steel < 0 {
-			ui.Message(fmt.Sprintf("You run out of steel after %v turns", turns))
-			p.steel = 0
-		} else if p.copper < 0 {
-			ui.Message(fmt.Sprintf("You run out of copper after %v turns", turns))
-			p.copper = 0
-		} else {
-			*damaged = false
-			ui.Message(fmt.Sprintf("Used %v steel and %v copper to repair the %v in %v turns",
-				st, cu, name, turns))
+	if damaged {
+		var st, cu int
+		st, cu, turns = cost.roll(rng)
+		if short := p.shortOf(st, cu); short != "" {
+			ui.Message(fmt.Sprintf("You do not have enough %v to repair the %v", short, name))
+			return 0
 		}
+		p.plan(Work{REPAIR, st, cu, name})
 	} else {
 		ui.Message(fmt.Sprintf("The %v does not need to be repaired", name))
 	}
 	return
 }
-func genericCreate(max_steel, max_copper, max_turns int, name string, ui UI, p *Player) (turns int) {
-	var st, cu int = 0, 0
-	if max_steel > 0 {
-		st = rand.Intn(max_steel)
-	}
-	if max_copper > 0 {
-		cu = rand.Intn(max_copper)
-	}
-	turns = 1 + rand.Intn(max_turns-1)
-
-	p.steel -= st
-	p.copper -= cu
-	if p.steel < 0 && p.copper < 0 {
-		ui.Message(fmt.Sprintf("You run out of both steel and copper after %v turns", turns))
-		p.steel = 0
-		p.copper = 0
-	} else if p.steel < 0 {
-		ui.Message(fmt.Sprintf("You run out of steel after %v turns", turns))
-		p.steel = 0
-	} else if p.copper < 0 {
-		ui.Message(fmt.Sprintf("You run out of copper after %v turns", turns))
-		p.copper = 0
-	} else {
-		ui.Message(fmt.Sprintf("Used %v steel and %v copper to create a %v section in %v turns",
-			st, cu, name, turns))
+func genericCreate(cost Cost, name string, ui UI, p *Player, rng *RNG) (turns int) {
+	st, cu, turns := cost.roll(rng)
+	if short := p.shortOf(st, cu); short != "" {
+		ui.Message(fmt.Sprintf("You do not have enough %v to build a %v", short, name))
+		return 0
 	}
+	p.plan(Work{CREATE, st, cu, name})
 	return
 }
 
 ///////////// VACUUM ////////////////////
 type Vacuum struct{}
 
-func (c *Vacuum) Description() string                { return "The cold vacuum of space" }
-func (c *Vacuum) Walkable() bool                     { return true }
-func (c *Vacuum) SeePast() bool                      { return true }
-func (c *Vacuum) AirFlows() bool                     { return true }
-func (c *Vacuum) AirSinkSource(float64) float64      { return 0 }
-func (c *Vacuum) EnergyFlows() bool                  { return false }
-func (c *Vacuum) EnergySinkSource(e float64) float64 { return e }
-func (c *Vacuum) Character() int32                   { return ' ' }
-func (c *Vacuum) Salvage(ui UI, p *Player) (int, Cell) {
+func (c *Vacuum) Description() string             { return "The cold vacuum of space" }
+func (c *Vacuum) Walkable() bool                  { return true }
+func (c *Vacuum) SeePast() bool                   { return true }
+func (c *Vacuum) AirFlows() bool                  { return true }
+func (c *Vacuum) AirSinkSource(a float64) float64 { return -a }
+func (c *Vacuum) EnergyFlows() bool               { return false }
+func (c *Vacuum) EnergySupply() float64           { return 0 }
+func (c *Vacuum) EnergyDemand() float64           { return 0 }
+func (c *Vacuum) EnergySupplied(float64)          {}
+func (c *Vacuum) Character() int32                { return ' ' }
+func (c *Vacuum) Style() Style                    { return Style{} }
+func (c *Vacuum) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
 	ui.Message("There is nothing to salvage in a vacuum")
 	return 0, c
 }
-func (c *Vacuum) Repair(ui UI, p *Player) (int, Cell) {
+func (c *Vacuum) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
 	ui.Message("You cannot repair a vacuum")
 	return 0, c
 }
-func (c *Vacuum) Create(ui UI, p *Player) int {
+func (c *Vacuum) Create(ui UI, p *Player, rng *RNG) int {
 	ui.Message("Nature abhors a vacuum")
 	return 0
 }
+func (c *Vacuum) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *Vacuum) ReplacedBy(over Cell) string { return "" }
 func (c *Vacuum) Activate(ui UI) int {
 	ui.Message("You activate the vacuum, the universe is re-created in a flash")
 	return 1
@@ -144,32 +168,44 @@ func (c *Vacuum) Activate(ui UI) int {
 ///////////////// FLOOR /////////////////
 type Floor struct{}
 
-func (c *Floor) Description() string                { return "The floor" }
-func (c *Floor) Walkable() bool                     { return true }
-func (c *Floor) SeePast() bool                      { return true }
-func (c *Floor) AirFlows() bool                     { return true }
-func (c *Floor) AirSinkSource(a float64) float64    { return a }
-func (c *Floor) EnergyFlows() bool                  { return false }
-func (c *Floor) EnergySinkSource(e float64) float64 { return e }
-func (c *Floor) Character() int32                   { return '.' }
-func (c *Floor) Salvage(ui UI, p *Player) (turns int, replacement Cell) {
+func (c *Floor) Description() string             { return "The floor" }
+func (c *Floor) Walkable() bool                  { return true }
+func (c *Floor) SeePast() bool                   { return true }
+func (c *Floor) AirFlows() bool                  { return true }
+func (c *Floor) AirSinkSource(a float64) float64 { return 0 }
+func (c *Floor) EnergyFlows() bool               { return false }
+func (c *Floor) EnergySupply() float64           { return 0 }
+func (c *Floor) EnergyDemand() float64           { return 0 }
+func (c *Floor) EnergySupplied(float64)          {}
+func (c *Floor) Character() int32                { return '.' }
+func (c *Floor) Style() Style                    { return Style{} }
+func (c *Floor) SalvageCost() Cost               { return Cost{10, 0, 10} }
+func (c *Floor) Salvage(ui UI, p *Player, rng *RNG) (turns int, replacement Cell) {
 	turns = 0
 	replacement = c
 
 	sure, aborted := ui.YesNoPrompt("Salvage floor?")
 	if !aborted && sure {
-		turns = genericSalvage(10, 0, 10, ui, p)
+		turns = genericSalvage(c.SalvageCost(), "floor", ui, p, rng)
 		replacement = new(Vacuum)
 	}
 	return
 }
-func (c *Floor) Repair(ui UI, p *Player) (int, Cell) {
+func (c *Floor) RepairCost() Cost { return Cost{} } // Floors are never damaged
+func (c *Floor) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
 	ui.Message("The floor does not need to be repaired")
 	return 0, c
 }
 
-func (c *Floor) Create(ui UI, p *Player) int {
-	return genericCreate(10, 0, 10, "floor", ui, p)
+func (c *Floor) Create(ui UI, p *Player, rng *RNG) int {
+	return genericCreate(Cost{10, 0, 10}, "floor", ui, p, rng)
+}
+func (c *Floor) BuildsOn(under Cell) string { return onOpenSpace(under) }
+func (c *Floor) ReplacedBy(over Cell) string {
+	if _, ok := over.(*Floor); ok {
+		return "There is already a floor here"
+	}
+	return ""
 }
 func (c *Floor) Activate(ui UI) int {
 	ui.Message("Nothing happens")
@@ -181,24 +217,40 @@ type Wall struct {
 	damaged bool
 }
 
-func (c *Wall) Description() string                { return "A wall" }
-func (w *Wall) Walkable() bool                     { return false }
-func (w *Wall) Character() int32                   { return '#' }
-func (w *Wall) SeePast() bool                      { return false }
-func (w *Wall) AirFlows() bool                     { return w.damaged }
-func (c *Wall) AirSinkSource(a float64) float64    { return a }
-func (w *Wall) EnergyFlows() bool                  { return false }
-func (c *Wall) EnergySinkSource(e float64) float64 { return e }
-func (c *Wall) Salvage(ui UI, p *Player) (turns int, replacement Cell) {
-	turns = genericSalvage(10, 0, 10, ui, p)
+func (c *Wall) Description() string             { return "A wall" }
+func (c *Wall) Damaged() bool                   { return c.damaged }
+func (w *Wall) Walkable() bool                  { return false }
+func (w *Wall) Character() int32                { return '#' }
+func (w *Wall) Style() Style                    { return damageStyle(w.damaged, Style{}) }
+func (w *Wall) SeePast() bool                   { return false }
+func (w *Wall) AirFlows() bool                  { return w.damaged }
+func (c *Wall) AirSinkSource(a float64) float64 { return 0 }
+func (w *Wall) EnergyFlows() bool               { return false }
+func (c *Wall) EnergySupply() float64           { return 0 }
+func (c *Wall) EnergyDemand() float64           { return 0 }
+func (c *Wall) EnergySupplied(float64)          {}
+func (c *Wall) SalvageCost() Cost               { return Cost{10, 0, 10} }
+func (c *Wall) Salvage(ui UI, p *Player, rng *RNG) (turns int, replacement Cell) {
+	turns = genericSalvage(c.SalvageCost(), "wall", ui, p, rng)
 	replacement = new(Floor)
 	return
 }
-func (c *Wall) Repair(ui UI, p *Player) (turns int, replacement Cell) {
-	return genericRepair(&c.damaged, 5, 0, 5, "wall", ui, p), c
+func (c *Wall) RepairCost() Cost { return Cost{5, 0, 5} }
+func (c *Wall) Repair(ui UI, p *Player, rng *RNG) (turns int, replacement Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "wall", ui, p, rng), c
 }
-func (c *Wall) Create(ui UI, p *Player) (turns int) {
-	return genericCreate(10, 0, 10, "wall", ui, p)
+func (c *Wall) Create(ui UI, p *Player, rng *RNG) (turns int) {
+	return genericCreate(Cost{10, 0, 10}, "wall", ui, p, rng)
+}
+func (c *Wall) BuildsOn(under Cell) string { return onOpenSpace(under) }
+func (c *Wall) ReplacedBy(over Cell) string {
+	if _, ok := over.(*WallConduit); !ok {
+		return mustSalvage("wall")
+	}
+	if c.damaged {
+		return "The wall is breached, repair it first"
+	}
+	return "" // Run a conduit through it
 }
 func (c *Wall) Activate(ui UI) int {
 	ui.Message("Nothing happens")
@@ -211,6 +263,7 @@ type Door struct {
 }
 
 func (c *Door) Description() string { return "A door" }
+func (c *Door) Damaged() bool       { return c.damaged }
 func (d *Door) Walkable() bool      { return d.open }
 func (d *Door) Character() int32 {
 	if d.open {
@@ -218,19 +271,37 @@ func (d *Door) Character() int32 {
 	}
 	return '+'
 }
-func (d *Door) SeePast() bool                      { return d.open }
-func (d *Door) AirFlows() bool                     { return d.open || d.damaged }
-func (c *Door) AirSinkSource(a float64) float64    { return a }
-func (d *Door) EnergyFlows() bool                  { return false }
-func (c *Door) EnergySinkSource(e float64) float64 { return e }
-func (c *Door) Salvage(ui UI, p *Player) (int, Cell) {
-	return genericSalvage(10, 10, 15, ui, p), new(Floor)
-}
-func (c *Door) Repair(ui UI, p *Player) (int, Cell) {
-	return genericRepair(&c.damaged, 5, 5, 10, "door", ui, p), c
-}
-func (c *Door) Create(ui UI, p *Player) (turns int) {
-	return genericCreate(10, 0, 10, "wall", ui, p)
+func (d *Door) Style() Style                    { return damageStyle(d.damaged, Style{fg: yellow}) }
+func (d *Door) SeePast() bool                   { return d.open }
+func (d *Door) AirFlows() bool                  { return d.open || d.damaged }
+func (c *Door) AirSinkSource(a float64) float64 { return 0 }
+func (d *Door) EnergyFlows() bool               { return false }
+func (c *Door) EnergySupply() float64           { return 0 }
+func (c *Door) EnergyDemand() float64           { return 0 }
+func (c *Door) EnergySupplied(float64)          {}
+func (c *Door) SalvageCost() Cost               { return Cost{10, 10, 15} }
+func (c *Door) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "door", ui, p, rng), new(Floor)
+}
+func (c *Door) RepairCost() Cost { return Cost{5, 5, 10} }
+func (c *Door) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "door", ui, p, rng), c
+}
+func (c *Door) Create(ui UI, p *Player, rng *RNG) (turns int) {
+	return genericCreate(Cost{15, 5, 15}, "door", ui, p, rng)
+}
+func (c *Door) BuildsOn(under Cell) string { return onOpenSpace(under) }
+func (c *Door) ReplacedBy(over Cell) string {
+	if _, ok := over.(*DoorConduit); !ok {
+		return mustSalvage("door")
+	}
+	if c.damaged {
+		return "The door is damaged, repair it first"
+	}
+	if c.open {
+		return "The door is open, close it first"
+	}
+	return "" // Run a conduit through its frame
 }
 func (c *Door) Activate(ui UI) int {
 	if c.damaged {
@@ -246,6 +317,67 @@ func (c *Door) Activate(ui UI) int {
 	return 1
 }
 
+/////////// BULKHEAD ////////////////////
+
+// A Bulkhead is a heavy door that slams shut by itself when the air around
+// it rushes away, see decompress. One opened by hand is held open until it
+// is closed by hand, and a damaged one is jammed where it is.
+type Bulkhead struct {
+	open, damaged bool
+	held          bool
+}
+
+func (c *Bulkhead) Description() string {
+	if c.damaged {
+		return "A jammed emergency bulkhead"
+	}
+	return "An emergency bulkhead"
+}
+func (c *Bulkhead) Damaged() bool  { return c.damaged }
+func (c *Bulkhead) Walkable() bool { return c.open }
+func (c *Bulkhead) Character() int32 {
+	if c.open {
+		return ':'
+	}
+	return 'H'
+}
+func (c *Bulkhead) Style() Style                    { return damageStyle(c.damaged, Style{fg: yellow, bold: true}) }
+func (c *Bulkhead) SeePast() bool                   { return c.open }
+func (c *Bulkhead) AirFlows() bool                  { return c.open || c.damaged }
+func (c *Bulkhead) AirSinkSource(a float64) float64 { return 0 }
+func (c *Bulkhead) EnergyFlows() bool               { return false }
+func (c *Bulkhead) EnergySupply() float64           { return 0 }
+func (c *Bulkhead) EnergyDemand() float64           { return 0 }
+func (c *Bulkhead) EnergySupplied(float64)          {}
+func (c *Bulkhead) SalvageCost() Cost               { return Cost{15, 5, 20} }
+func (c *Bulkhead) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "bulkhead", ui, p, rng), new(Floor)
+}
+func (c *Bulkhead) RepairCost() Cost { return Cost{10, 5, 15} }
+func (c *Bulkhead) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "bulkhead", ui, p, rng), c
+}
+func (c *Bulkhead) Create(ui UI, p *Player, rng *RNG) int {
+	ui.Message("You cannot create a bulkhead from scratch")
+	return 0
+}
+func (c *Bulkhead) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *Bulkhead) ReplacedBy(over Cell) string { return mustSalvage("bulkhead") }
+func (c *Bulkhead) Activate(ui UI) int {
+	if c.damaged {
+		ui.Message("The bulkhead is jammed and will not move")
+		return 1
+	}
+	if c.open {
+		ui.Message("The bulkhead grinds shut")
+	} else {
+		ui.Message("The bulkhead grinds open and locks")
+	}
+	c.open = !c.open
+	c.held = c.open
+	return 1
+}
+
 //////////////// CONDUIT /////////////////////
 
 type Conduit struct {
@@ -258,27 +390,35 @@ func (c *Conduit) Description() string {
 	}
 	return "An energy conduit"
 }
-func (c *Conduit) Walkable() bool                     { return true }
-func (c *Conduit) SeePast() bool                      { return true }
-func (c *Conduit) AirFlows() bool                     { return true }
-func (c *Conduit) AirSinkSource(a float64) float64    { return a }
-func (c *Conduit) EnergyFlows() bool                  { return !c.damaged }
-func (c *Conduit) EnergySinkSource(e float64) float64 { return e }
+func (c *Conduit) Damaged() bool                   { return c.damaged }
+func (c *Conduit) Walkable() bool                  { return true }
+func (c *Conduit) SeePast() bool                   { return true }
+func (c *Conduit) AirFlows() bool                  { return true }
+func (c *Conduit) AirSinkSource(a float64) float64 { return 0 }
+func (c *Conduit) EnergyFlows() bool               { return !c.damaged }
+func (c *Conduit) EnergySupply() float64           { return 0 }
+func (c *Conduit) EnergyDemand() float64           { return 0 }
+func (c *Conduit) EnergySupplied(float64)          {}
 func (c *Conduit) Character() int32 {
 	if c.damaged {
 		return '~'
 	}
 	return '-'
 }
-func (c *Conduit) Salvage(ui UI, p *Player) (int, Cell) {
-	return genericSalvage(0, 10, 10, ui, p), new(Floor)
+func (c *Conduit) Style() Style      { return damageStyle(c.damaged, Style{}) }
+func (c *Conduit) SalvageCost() Cost { return Cost{0, 10, 10} }
+func (c *Conduit) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "conduit", ui, p, rng), new(Floor)
 }
-func (c *Conduit) Repair(ui UI, p *Player) (int, Cell) {
-	return genericRepair(&c.damaged, 0, 10, 5, "conduit", ui, p), c
+func (c *Conduit) RepairCost() Cost { return Cost{0, 10, 5} }
+func (c *Conduit) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "conduit", ui, p, rng), c
 }
-func (c *Conduit) Create(ui UI, p *Player) int {
-	return genericCreate(0, 15, 10, "conduit", ui, p)
+func (c *Conduit) Create(ui UI, p *Player, rng *RNG) int {
+	return genericCreate(Cost{0, 15, 10}, "conduit", ui, p, rng)
 }
+func (c *Conduit) BuildsOn(under Cell) string  { return onOpenSpace(under) }
+func (c *Conduit) ReplacedBy(over Cell) string { return mustSalvage("conduit") }
 func (c *Conduit) Activate(ui UI) int {
 	ui.Message("Nothing happens")
 	return 1
@@ -296,66 +436,150 @@ func (c *WallConduit) Description() string {
 	}
 	return "An energy conduit passes through a wall here"
 }
-func (c *WallConduit) Walkable() bool                     { return false }
-func (c *WallConduit) SeePast() bool                      { return false }
-func (c *WallConduit) AirFlows() bool                     { return c.damaged }
-func (c *WallConduit) AirSinkSource(a float64) float64    { return a }
-func (c *WallConduit) EnergyFlows() bool                  { return !c.damaged }
-func (c *WallConduit) EnergySinkSource(e float64) float64 { return e }
+func (c *WallConduit) Damaged() bool                   { return c.damaged }
+func (c *WallConduit) Walkable() bool                  { return false }
+func (c *WallConduit) SeePast() bool                   { return false }
+func (c *WallConduit) AirFlows() bool                  { return c.damaged }
+func (c *WallConduit) AirSinkSource(a float64) float64 { return 0 }
+func (c *WallConduit) EnergyFlows() bool               { return !c.damaged }
+func (c *WallConduit) EnergySupply() float64           { return 0 }
+func (c *WallConduit) EnergyDemand() float64           { return 0 }
+func (c *WallConduit) EnergySupplied(float64)          {}
 func (c *WallConduit) Character() int32 {
 	if c.damaged {
 		return '%'
 	}
 	return '*'
 }
-func (c *WallConduit) Salvage(ui UI, p *Player) (int, Cell) {
-	return genericSalvage(10, 10, 15, ui, p), new(Floor)
+func (c *WallConduit) Style() Style      { return damageStyle(c.damaged, Style{}) }
+func (c *WallConduit) SalvageCost() Cost { return Cost{10, 10, 15} }
+func (c *WallConduit) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "wall conduit", ui, p, rng), new(Floor)
 }
-func (c *WallConduit) Repair(ui UI, p *Player) (int, Cell) {
-	return genericRepair(&c.damaged, 10, 10, 15, "conduit", ui, p), c
+func (c *WallConduit) RepairCost() Cost { return Cost{10, 10, 15} }
+func (c *WallConduit) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "wall conduit", ui, p, rng), c
 }
-func (c *WallConduit) Create(ui UI, p *Player) int {
-	return genericCreate(15, 15, 15, "conduit", ui, p)
+func (c *WallConduit) Create(ui UI, p *Player, rng *RNG) int {
+	return genericCreate(Cost{15, 15, 15}, "wall conduit", ui, p, rng)
+}
+func (c *WallConduit) BuildsOn(under Cell) string {
+	if _, ok := under.(*Wall); ok {
+		return ""
+	}
+	return onOpenSpace(under)
 }
+func (c *WallConduit) ReplacedBy(over Cell) string { return mustSalvage("wall conduit") }
 func (c *WallConduit) Activate(ui UI) int {
 	ui.Message("Nothing happens")
 	return 1
 }
 
+//////////////// DOOR CONDUIT /////////////////////
+
+// A door whose frame carries an energy conduit, open or shut.
+type DoorConduit struct {
+	open, damaged bool
+}
+
+func (c *DoorConduit) Description() string {
+	if c.damaged {
+		return "A door, a burned out energy conduit runs through its frame"
+	}
+	return "A door, an energy conduit runs through its frame"
+}
+func (c *DoorConduit) Damaged() bool  { return c.damaged }
+func (c *DoorConduit) Walkable() bool { return c.open }
+func (c *DoorConduit) Character() int32 {
+	if c.open {
+		return '\''
+	}
+	return '&'
+}
+func (c *DoorConduit) Style() Style                    { return damageStyle(c.damaged, Style{fg: yellow}) }
+func (c *DoorConduit) SeePast() bool                   { return c.open }
+func (c *DoorConduit) AirFlows() bool                  { return c.open || c.damaged }
+func (c *DoorConduit) AirSinkSource(a float64) float64 { return 0 }
+func (c *DoorConduit) EnergyFlows() bool               { return !c.damaged }
+func (c *DoorConduit) EnergySupply() float64           { return 0 }
+func (c *DoorConduit) EnergyDemand() float64           { return 0 }
+func (c *DoorConduit) EnergySupplied(float64)          {}
+func (c *DoorConduit) SalvageCost() Cost               { return Cost{10, 15, 15} }
+func (c *DoorConduit) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "door conduit", ui, p, rng), new(Floor)
+}
+func (c *DoorConduit) RepairCost() Cost { return Cost{5, 10, 10} }
+func (c *DoorConduit) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "door conduit", ui, p, rng), c
+}
+func (c *DoorConduit) Create(ui UI, p *Player, rng *RNG) int {
+	return genericCreate(Cost{15, 15, 15}, "door conduit", ui, p, rng)
+}
+func (c *DoorConduit) BuildsOn(under Cell) string {
+	if _, ok := under.(*Door); ok {
+		return ""
+	}
+	return onOpenSpace(under)
+}
+func (c *DoorConduit) ReplacedBy(over Cell) string { return mustSalvage("door conduit") }
+func (c *DoorConduit) Activate(ui UI) int {
+	if c.damaged {
+		ui.Message("The door is damaged and will not move")
+		return 1
+	}
+	if c.open {
+		ui.Message("The door closes")
+	} else {
+		ui.Message("The door opens")
+	}
+	c.open = !c.open
+	return 1
+}
+
 ///////////// POWER PLANT /////////////////
 
+const powerPlantSupply = 9.0
+
 type PowerPlant struct {
 	damaged bool
 }
 
 func (c *PowerPlant) Description() string             { return "An energy generator" }
+func (c *PowerPlant) Damaged() bool                   { return c.damaged }
 func (c *PowerPlant) Walkable() bool                  { return false }
 func (c *PowerPlant) SeePast() bool                   { return false }
 func (c *PowerPlant) AirFlows() bool                  { return false }
-func (c *PowerPlant) AirSinkSource(a float64) float64 { return a }
+func (c *PowerPlant) AirSinkSource(a float64) float64 { return 0 }
 func (c *PowerPlant) EnergyFlows() bool               { return !c.damaged }
-func (c *PowerPlant) EnergySinkSource(e float64) float64 {
+func (c *PowerPlant) EnergySupply() float64 {
 	if !c.damaged {
-		return 9
+		return powerPlantSupply
 	}
-	return e
+	return 0
 }
+func (c *PowerPlant) EnergyDemand() float64  { return 0 }
+func (c *PowerPlant) EnergySupplied(float64) {}
 func (c *PowerPlant) Character() int32 {
 	if c.damaged {
 		return 'p'
 	}
 	return 'P'
 }
-func (c *PowerPlant) Salvage(ui UI, p *Player) (int, Cell) {
-	return genericSalvage(10, 10, 20, ui, p), new(Floor)
+func (c *PowerPlant) Style() Style      { return damageStyle(c.damaged, Style{fg: magenta, bold: true}) }
+func (c *PowerPlant) SalvageCost() Cost { return Cost{10, 10, 20} }
+func (c *PowerPlant) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "power plant", ui, p, rng), new(Floor)
 }
-func (c *PowerPlant) Repair(ui UI, p *Player) (int, Cell) {
-	return genericRepair(&c.damaged, 10, 10, 15, "power plant", ui, p), c
+func (c *PowerPlant) RepairCost() Cost { return Cost{10, 10, 15} }
+func (c *PowerPlant) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "power plant", ui, p, rng), c
 }
-func (c *PowerPlant) Create(ui UI, p *Player) int {
+func (c *PowerPlant) Create(ui UI, p *Player, rng *RNG) int {
 	ui.Message("You cannot create a power plant from scratch")
 	return 0
 }
+func (c *PowerPlant) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *PowerPlant) ReplacedBy(over Cell) string { return mustSalvage("power plant") }
 func (c *PowerPlant) Activate(ui UI) int {
 	ui.Message("Nothing happens")
 	return 1
@@ -363,46 +587,60 @@ func (c *PowerPlant) Activate(ui UI) int {
 
 ///////////// AIR PLANT /////////////////
 
+const (
+	airPlantRate     = 1.0 // Air made per turn when fully powered
+	airPlantPressure = 9.0 // Stops making air at this pressure
+	airPlantDemand   = 3.0 // Energy needed per turn to run at full rate
+)
+
 type AirPlant struct {
 	damaged bool
 	energy  float64
 }
 
 func (c *AirPlant) Description() string { return "An air generator" }
+func (c *AirPlant) Damaged() bool       { return c.damaged }
 func (c *AirPlant) Walkable() bool      { return false }
 func (c *AirPlant) SeePast() bool       { return false }
 func (c *AirPlant) AirFlows() bool      { return !c.damaged }
 func (c *AirPlant) AirSinkSource(a float64) float64 {
 	Dlog.Println("<> AirPlant")
-	if !c.damaged && c.energy > 5 {
-		return 9
+	if !c.damaged && c.energy > 0 && a < airPlantPressure {
+		// Makes air in proportion to the power it gets
+		return math.Min(airPlantRate*c.energy/airPlantDemand, airPlantPressure-a)
 	}
-	return a
+	return 0
 }
-func (c *AirPlant) EnergyFlows() bool { return true }
-func (c *AirPlant) EnergySinkSource(e float64) float64 {
-	c.energy = e
-	if e > 5 {
-		return e - (e-5)/50
+func (c *AirPlant) EnergyFlows() bool     { return true }
+func (c *AirPlant) EnergySupply() float64 { return 0 }
+func (c *AirPlant) EnergyDemand() float64 {
+	if c.damaged {
+		return 0
 	}
-	return e
+	return airPlantDemand
 }
+func (c *AirPlant) EnergySupplied(e float64) { c.energy = e }
 func (c *AirPlant) Character() int32 {
 	if c.damaged {
 		return 'a'
 	}
 	return 'A'
 }
-func (c *AirPlant) Salvage(ui UI, p *Player) (int, Cell) {
-	return genericSalvage(10, 10, 20, ui, p), new(Floor)
+func (c *AirPlant) Style() Style      { return damageStyle(c.damaged, Style{fg: cyan, bold: true}) }
+func (c *AirPlant) SalvageCost() Cost { return Cost{10, 10, 20} }
+func (c *AirPlant) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "air plant", ui, p, rng), new(Floor)
 }
-func (c *AirPlant) Repair(ui UI, p *Player) (int, Cell) {
-	return genericRepair(&c.damaged, 10, 10, 15, "air plant", ui, p), c
+func (c *AirPlant) RepairCost() Cost { return Cost{10, 10, 15} }
+func (c *AirPlant) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "air plant", ui, p, rng), c
 }
-func (c *AirPlant) Create(ui UI, p *Player) int {
+func (c *AirPlant) Create(ui UI, p *Player, rng *RNG) int {
 	ui.Message("You cannot create a air plant from scratch")
 	return 0
 }
+func (c *AirPlant) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *AirPlant) ReplacedBy(over Cell) string { return mustSalvage("air plant") }
 func (c *AirPlant) Activate(ui UI) int {
 	ui.Message("Nothing happens")
 	return 1
@@ -413,28 +651,118 @@ func (c *AirPlant) Activate(ui UI) int {
 type EntranceExit struct {
 }
 
-func (c *EntranceExit) Description() string                { return "Your ship, safety" }
-func (c *EntranceExit) Walkable() bool                     { return true }
-func (c *EntranceExit) SeePast() bool                      { return true }
-func (c *EntranceExit) AirFlows() bool                     { return true }
-func (c *EntranceExit) AirSinkSource(a float64) float64    { return 9 }
-func (c *EntranceExit) EnergyFlows() bool                  { return false }
-func (c *EntranceExit) EnergySinkSource(e float64) float64 { return 0 }
-func (c *EntranceExit) Character() int32                   { return '.' }
-func (c *EntranceExit) Salvage(ui UI, p *Player) (int, Cell) {
+func (c *EntranceExit) Description() string             { return "Your ship, safety" }
+func (c *EntranceExit) Walkable() bool                  { return true }
+func (c *EntranceExit) SeePast() bool                   { return true }
+func (c *EntranceExit) AirFlows() bool                  { return true }
+func (c *EntranceExit) AirSinkSource(a float64) float64 { return 9 - a }
+func (c *EntranceExit) EnergyFlows() bool               { return false }
+func (c *EntranceExit) EnergySupply() float64           { return 0 }
+func (c *EntranceExit) EnergyDemand() float64           { return 0 }
+func (c *EntranceExit) EnergySupplied(float64)          {}
+func (c *EntranceExit) Character() int32                { return '.' }
+func (c *EntranceExit) Style() Style                    { return Style{fg: green, bold: true} }
+func (c *EntranceExit) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
 	ui.Message("Why would you salvage your own ship?")
 	return 0, c
 }
-func (c *EntranceExit) Repair(ui UI, p *Player) (int, Cell) {
+func (c *EntranceExit) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
 	ui.Message("Your own ship does not need repair")
 	return 0, c
 }
-func (c *EntranceExit) Create(ui UI, p *Player) int {
+func (c *EntranceExit) Create(ui UI, p *Player, rng *RNG) int {
 	Dlog.Println("<> BUG EntranceExit.Create")
 	ui.Message("Create shold never be called on an EntranceExit cell")
 	return 0
 }
+func (c *EntranceExit) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *EntranceExit) ReplacedBy(over Cell) string { return "You cannot build over your own ship" }
 func (c *EntranceExit) Activate(ui UI) int {
 	ui.Message("Nothing happens")
 	return 1
 }
+
+///////////// BATTERY /////////////////
+
+// Cells that store energy. When a network has energy to spare it goes into
+// stores that are charging, when it is short stores that are discharging make
+// up the difference.
+type EnergyStore interface {
+	Discharging() bool
+	ChargeRoom() float64 // How much more can be stored this turn
+	Available() float64  // How much can be given up this turn
+	Charge(float64)      // Store energy, or give it up if negative
+	Level() float64      // Fraction of capacity stored
+}
+
+const (
+	batteryCapacity = 100.0
+	batteryRate     = 5.0 // Most it can store or give up per turn
+)
+
+type Battery struct {
+	damaged     bool
+	discharging bool
+	charge      float64
+}
+
+func (c *Battery) Description() string {
+	mode := "charging"
+	if c.discharging {
+		mode = "discharging"
+	}
+	if c.damaged {
+		return "A damaged battery"
+	}
+	return fmt.Sprintf("A battery, %v, %.0f%% charged", mode, 100*c.Level())
+}
+func (c *Battery) Damaged() bool                   { return c.damaged }
+func (c *Battery) Walkable() bool                  { return false }
+func (c *Battery) SeePast() bool                   { return false }
+func (c *Battery) AirFlows() bool                  { return false }
+func (c *Battery) AirSinkSource(a float64) float64 { return 0 }
+func (c *Battery) EnergyFlows() bool               { return !c.damaged }
+func (c *Battery) EnergySupply() float64           { return 0 }
+func (c *Battery) EnergyDemand() float64           { return 0 }
+func (c *Battery) EnergySupplied(float64)          {}
+func (c *Battery) Discharging() bool               { return c.discharging }
+func (c *Battery) ChargeRoom() float64 {
+	return math.Min(batteryRate, batteryCapacity-c.charge)
+}
+func (c *Battery) Available() float64 { return math.Min(batteryRate, c.charge) }
+func (c *Battery) Charge(e float64)   { c.charge = math.Max(0, math.Min(batteryCapacity, c.charge+e)) }
+func (c *Battery) Level() float64     { return c.charge / batteryCapacity }
+func (c *Battery) Character() int32 {
+	if c.damaged {
+		return 'b'
+	}
+	return 'B'
+}
+func (c *Battery) Style() Style      { return damageStyle(c.damaged, Style{fg: green}) }
+func (c *Battery) SalvageCost() Cost { return Cost{5, 15, 15} }
+func (c *Battery) Salvage(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericSalvage(c.SalvageCost(), "battery", ui, p, rng), new(Floor)
+}
+func (c *Battery) RepairCost() Cost { return Cost{5, 10, 10} }
+func (c *Battery) Repair(ui UI, p *Player, rng *RNG) (int, Cell) {
+	return genericRepair(c.damaged, c.RepairCost(), "battery", ui, p, rng), c
+}
+func (c *Battery) Create(ui UI, p *Player, rng *RNG) int {
+	ui.Message("You cannot create a battery from scratch")
+	return 0
+}
+func (c *Battery) BuildsOn(under Cell) string  { return cannotBuild() }
+func (c *Battery) ReplacedBy(over Cell) string { return mustSalvage("battery") }
+func (c *Battery) Activate(ui UI) int {
+	if c.damaged {
+		ui.Message("The battery is damaged and does not respond")
+		return 1
+	}
+	c.discharging = !c.discharging
+	if c.discharging {
+		ui.Message("The battery switches to discharging")
+	} else {
+		ui.Message("The battery switches to charging")
+	}
+	return 1
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// The cell tests drive Player.Action against every cell type through a
+// HeadlessUI.
+
+// testBench puts the player at 0,0 of a 2x1 level with the cell to their east
+// and enough materials to build or repair anything.
+func testBench(cell Cell, answers ...Answer) (*Level, *Player, *HeadlessUI) {
+	level := new(Level)
+	level.x, level.y = 2, 1
+	level.Init()
+	level.rng = NewRNG(1)
+	level.cells[0][0] = new(Floor)
+	level.cells[1][0] = cell
+
+	player := new(Player)
+	player.Init()
+	player.x, player.y = 0, 0
+	player.steel, player.copper = 1000, 1000
+	return level, player, NewHeadlessUI(level, player, answers...)
+}
+
+// act does an action and works any job it starts through to the end,
+// returning the turns it all took.
+func act(level *Level, player *Player, ui *HeadlessUI, action int) int {
+	turns := player.Action(level, ui, action)
+	for player.Working() {
+		player.Work(level, ui, player.Watch(level))
+		turns++
+	}
+	return turns
+}
+
+func kind(c Cell) string { return saveCell(c).Kind }
+
+func damaged(c Cell) bool { return saveCell(c).Damaged }
+
+var cellTests = []struct {
+	new      func() Cell
+	salvaged string // What salvaging leaves, "" if it cannot be salvaged
+	repairs  bool   // Has a damaged state that can be repaired
+	creates  bool   // Can be created from scratch
+}{
+	{func() Cell { return new(Vacuum) }, "", false, false},
+	{func() Cell { return new(Floor) }, "Vacuum", false, true},
+	{func() Cell { return &Wall{damaged: true} }, "Floor", true, true},
+	{func() Cell { return &Door{damaged: true} }, "Floor", true, true},
+	{func() Cell { return &Conduit{damaged: true} }, "Floor", true, true},
+	{func() Cell { return &WallConduit{damaged: true} }, "Floor", true, true},
+	{func() Cell { return &DoorConduit{damaged: true} }, "Floor", true, true},
+	{func() Cell { return &PowerPlant{damaged: true} }, "Floor", true, false},
+	{func() Cell { return &AirPlant{damaged: true} }, "Floor", true, false},
+	{func() Cell { return new(EntranceExit) }, "", false, false},
+	{func() Cell { return &Battery{damaged: true} }, "Floor", true, false},
+	{func() Cell { return &Bulkhead{damaged: true} }, "Floor", true, false},
+}
+
+func TestSalvage(t *testing.T) {
+	for _, ct := range cellTests {
+		name := kind(ct.new())
+		level, player, ui := testBench(ct.new(), DirectionAnswer(1, 0), YesNoAnswer(true))
+		turns := act(level, player, ui, SALVAGE)
+		after := kind(level.cells[1][0])
+		if ct.salvaged == "" {
+			if !(turns == 0 && after == name) {
+				t.Errorf("salvage %v: took %v turns leaving %v", name, turns, after)
+			}
+		} else {
+			if !(turns > 0 && after == ct.salvaged) {
+				t.Errorf("salvage %v: took %v turns leaving %v", name, turns, after)
+			}
+			if !(player.steel >= 1000 && player.copper >= 1000) {
+				t.Errorf("salvage %v: lost materials", name)
+			}
+		}
+		if ui.LastMessage() == "" {
+			t.Errorf("salvage %v: no message", name)
+		}
+
+		// Refusing or aborting never changes anything
+		if name == "Floor" {
+			level, player, ui = testBench(ct.new(), DirectionAnswer(1, 0), YesNoAnswer(false))
+			turns = act(level, player, ui, SALVAGE)
+			if !(turns == 0 && kind(level.cells[1][0]) == name) {
+				t.Errorf("salvage %v: refused but took %v turns", name, turns)
+			}
+		}
+		level, player, ui = testBench(ct.new(), AbortAnswer())
+		turns = act(level, player, ui, SALVAGE)
+		if !(turns == 0 && kind(level.cells[1][0]) == name) {
+			t.Errorf("salvage %v: aborted but took %v turns", name, turns)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	for _, ct := range cellTests {
+		name := kind(ct.new())
+		level, player, ui := testBench(ct.new(), DirectionAnswer(1, 0))
+		turns := act(level, player, ui, REPAIR)
+		after := level.cells[1][0]
+		if kind(after) != name {
+			t.Errorf("repair %v: became %v", name, kind(after))
+		}
+		if damaged(after) {
+			t.Errorf("repair %v: still damaged", name)
+		}
+		if ui.LastMessage() == "" {
+			t.Errorf("repair %v: no message", name)
+		}
+		if ct.repairs {
+			if turns <= 0 {
+				t.Errorf("repair %v: took no time", name)
+			}
+			if !(player.steel < 1000 || player.copper < 1000 || strings.Contains(ui.LastMessage(), "0 steel and 0 copper")) {
+				t.Errorf("repair %v: used no materials: %v", name, ui.LastMessage())
+			}
+
+			// Repairing again is just an inspection
+			ui.Script(DirectionAnswer(1, 0))
+			steel, copper := player.steel, player.copper
+			turns = act(level, player, ui, REPAIR)
+			if !(turns <= 1 && steel == player.steel && copper == player.copper) {
+				t.Errorf("repair %v: repaired twice", name)
+			}
+		}
+
+		// Without the materials the repair is refused before it starts
+		if ct.repairs {
+			level, player, ui = testBench(ct.new(), DirectionAnswer(1, 0))
+			player.steel, player.copper = 0, 0
+			player.Action(level, ui, REPAIR)
+			if player.job != nil && (player.job.work.steel > 0 || player.job.work.copper > 0) {
+				t.Errorf("repair %v: started without the materials", name)
+			}
+			if player.job == nil && !strings.Contains(ui.LastMessage(), "not have enough") {
+				t.Errorf("repair %v: refused with %q", name, ui.LastMessage())
+			}
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	// Every cell's own Create
+	for _, ct := range cellTests {
+		c := ct.new()
+		name := kind(c)
+		_, player, ui := testBench(new(Vacuum))
+		turns := c.Create(ui, player, NewRNG(1))
+		if ct.creates {
+			if turns <= 0 {
+				t.Errorf("create %v: took no time", name)
+			}
+			if !(player.planned != nil && player.planned.action == CREATE) {
+				t.Errorf("create %v: planned no work", name)
+			}
+		} else {
+			if turns != 0 {
+				t.Errorf("create %v: should not be creatable", name)
+			}
+			if ui.LastMessage() == "" {
+				t.Errorf("create %v: no message", name)
+			}
+		}
+	}
+
+	// And through the create menu
+	menu := []string{"Floor", "Wall", "Conduit", "WallConduit", "Door", "DoorConduit"}
+	for option, want := range menu {
+		level, player, ui := testBench(new(Vacuum), DirectionAnswer(1, 0), MenuAnswer(option))
+		turns := act(level, player, ui, CREATE)
+		if !(turns > 0 && kind(level.cells[1][0]) == want) {
+			t.Errorf("create menu %v: took %v turns and made %v", want, turns, kind(level.cells[1][0]))
+		}
+	}
+	level, player, ui := testBench(new(Vacuum), DirectionAnswer(1, 0), AbortAnswer())
+	turns := act(level, player, ui, CREATE)
+	if !(turns == 0 && kind(level.cells[1][0]) == "Vacuum") {
+		t.Errorf("create menu aborted but took %v turns", turns)
+	}
+
+	// What may be built over what
+	builds := []struct {
+		option int
+		onto   Cell
+		ok     bool
+	}{
+		{FLOOR, new(Floor), false},
+		{WALL, new(Floor), true},
+		{WALL, new(PowerPlant), false},
+		{WALL, new(Wall), false},
+		{WALL_CONDUIT, new(Wall), true},
+		{WALL_CONDUIT, &Wall{damaged: true}, false},
+		{DOOR_CONDUIT, new(Door), true},
+		{DOOR_CONDUIT, &Door{damaged: true}, false},
+		{DOOR_CONDUIT, &Door{open: true}, false},
+		{DOOR_CONDUIT, new(Wall), false},
+		{CONDUIT, new(Battery), false},
+		{CONDUIT, new(EntranceExit), false},
+	}
+	for _, b := range builds {
+		onto := kind(b.onto)
+		level, player, ui = testBench(b.onto, DirectionAnswer(1, 0), MenuAnswer(b.option))
+		turns = act(level, player, ui, CREATE)
+		built := kind(level.cells[1][0]) != onto
+		if !(built == b.ok && (turns > 0) == b.ok) {
+			t.Errorf("create %v onto %v: built %v in %v turns", menu[b.option], onto, built, turns)
+		}
+		if !b.ok {
+			if ui.LastMessage() == "" {
+				t.Errorf("create %v onto %v: refused without a reason", menu[b.option], onto)
+			}
+		}
+	}
+
+	// Not where the player stands, nor off the map
+	level, player, ui = testBench(new(Floor), DirectionAnswer(0, 0))
+	turns = act(level, player, ui, CREATE)
+	if !(turns == 0 && kind(level.cells[0][0]) == "Floor") {
+		t.Errorf("create under the player took %v turns", turns)
+	}
+	ui.Script(DirectionAnswer(0, 0))
+	turns = act(level, player, ui, SALVAGE)
+	if !(turns == 0 && kind(level.cells[0][0]) == "Floor") {
+		t.Errorf("salvage under the player took %v turns", turns)
+	}
+	ui.Script(DirectionAnswer(-1, 0))
+	turns = act(level, player, ui, SALVAGE)
+	if !(turns == 0 && ui.LastMessage() == "There is nothing there") {
+		t.Errorf("salvage off the map took %v turns", turns)
+	}
+
+	// A door conduit carries energy whether it is open or not
+	door := new(DoorConduit)
+	if !(door.EnergyFlows() && !door.Walkable()) {
+		t.Errorf("closed door conduit")
+	}
+	door.Activate(ui)
+	if !(door.EnergyFlows() && door.Walkable()) {
+		t.Errorf("open door conduit")
+	}
+}
+
+func TestActivate(t *testing.T) {
+	for _, ct := range cellTests {
+		name := kind(ct.new())
+		level, player, ui := testBench(ct.new(), DirectionAnswer(1, 0))
+		player.Action(level, ui, ACTIVATE)
+		if kind(level.cells[1][0]) != name {
+			t.Errorf("activate %v: became %v", name, kind(level.cells[1][0]))
+		}
+		if ui.LastMessage() == "" {
+			t.Errorf("activate %v: no message", name)
+		}
+	}
+
+	// Doors open and close, unless they are damaged
+	level, player, ui := testBench(new(Door), DirectionAnswer(1, 0))
+	player.Action(level, ui, ACTIVATE)
+	door := level.cells[1][0].(*Door)
+	if !(door.open && door.Walkable() && door.AirFlows()) {
+		t.Errorf("activate Door: did not open")
+	}
+	ui.Script(DirectionAnswer(1, 0))
+	player.Action(level, ui, ACTIVATE)
+	if !(!door.open && !door.Walkable()) {
+		t.Errorf("activate Door: did not close")
+	}
+
+	level, player, ui = testBench(&Door{damaged: true}, DirectionAnswer(1, 0))
+	player.Action(level, ui, ACTIVATE)
+	if level.cells[1][0].(*Door).open {
+		t.Errorf("activate Door: damaged door opened")
+	}
+}
+
+func TestBattery(t *testing.T) {
+	// P-B-A where the battery can be switched and the plant broken
+	level := new(Level)
+	level.x, level.y = 5, 2
+	level.Init()
+	level.rng = NewRNG(1)
+	power, battery, plant := new(PowerPlant), new(Battery), new(AirPlant)
+	for i, c := range []Cell{power, new(Conduit), battery, new(Conduit), plant} {
+		level.cells[i][0] = c
+		level.cells[i][1] = new(Floor)
+	}
+	player := new(Player)
+	player.Init()
+	player.x, player.y = 2, 1
+	ui := NewHeadlessUI(level, player)
+
+	// Charges from the surplus without starving the air plant
+	level.energy.ProcessFlow(level.cells)
+	if battery.charge != math.Min(batteryRate, powerPlantSupply-airPlantDemand) {
+		t.Errorf("charged %v from the surplus", battery.charge)
+	}
+	if plant.energy != airPlantDemand {
+		t.Errorf("air plant only got %v while charging", plant.energy)
+	}
+	for i := 0; i < 100; i++ {
+		level.energy.ProcessFlow(level.cells)
+	}
+	if battery.charge != batteryCapacity {
+		t.Errorf("only charged to %v", battery.charge)
+	}
+	if level.energy.energy[2][0] != fullEnergy {
+		t.Errorf("full battery reads %v", level.energy.energy[2][0])
+	}
+
+	// A charging battery keeps its charge when the plant fails
+	power.damaged = true
+	level.energy.Invalidate(0, 0)
+	level.energy.ProcessFlow(level.cells)
+	if !(plant.energy == 0 && battery.charge == batteryCapacity) {
+		t.Errorf("discharged while charging")
+	}
+
+	// Switched to discharge it keeps the air plant going until it runs down
+	ui.Script(DirectionAnswer(0, -1))
+	player.Action(level, ui, ACTIVATE)
+	if !battery.discharging {
+		t.Errorf("activating did not switch to discharging")
+	}
+	level.energy.ProcessFlow(level.cells)
+	if !(plant.energy == airPlantDemand && battery.charge == batteryCapacity-airPlantDemand) {
+		t.Errorf("gave the air plant %v leaving %v", plant.energy, battery.charge)
+	}
+	for i := 0; i < 100; i++ {
+		level.energy.ProcessFlow(level.cells)
+	}
+	if !(plant.energy == 0 && battery.charge == 0) {
+		t.Errorf("did not run down, %v left", battery.charge)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+////////////////////// COLOUR /////////////////////////
+
+// Colours and attributes are described here, each UI turns them into what
+// its terminal can show. On a terminal without colour only the attributes
+// are shown.
+
+type Colour int
+
+// In the order curses numbers them, after the terminal's own default
+const (
+	defaultColour Colour = iota
+	black
+	red
+	green
+	yellow
+	blue
+	magenta
+	cyan
+	white
+)
+
+type Style struct {
+	fg, bg             Colour
+	bold, dim, reverse bool
+}
+
+var (
+	damagedStyle = Style{fg: red}
+	liveStyle    = Style{fg: yellow, bold: true} // A conduit carrying energy
+	playerStyle  = Style{bold: true}
+)
+
+// damageStyle is the style of a cell that may be damaged.
+func damageStyle(damaged bool, working Style) Style {
+	if damaged {
+		return damagedStyle
+	}
+	return working
+}
+
+// StyleAt is how the cell at x, y should look, conduits that are carrying
+// energy are highlighted.
+func (level *Level) StyleAt(x, y int) Style {
+	if level.liveConduit(x, y) {
+		return liveStyle
+	}
+	return level.cells[x][y].(Drawable).Style()
+}
+
+// liveConduit reports whether the cell at x, y is a conduit carrying energy
+func (level *Level) liveConduit(x, y int) bool {
+	c := level.cells[x][y]
+	switch c.(type) {
+	case *Conduit, *WallConduit, *DoorConduit:
+		return c.EnergyFlows() && level.energy.energy[x][y] > 0
+	}
+	return false
+}
+
+// overlayStyle shades a reading from 0 up to fullEnergy or more, the same
+// scale the air and energy overlays and sensors use.
+func overlayStyle(v float64) Style {
+	switch {
+	case v < 0.5:
+		return Style{}
+	case v < 3:
+		return Style{fg: black, bg: red}
+	case v < 6:
+		return Style{fg: black, bg: yellow}
+	case v < 9:
+		return Style{fg: black, bg: green}
+	}
+	return Style{fg: black, bg: cyan}
+}
+
+// Each foreground and background pair of two different curses colours has
+// a colour pair from 1 to 56, numbered by fg and then by bg skipping fg.
+// Pair 0 is the terminal's own colours and cannot be changed, it also stands
+// in for text the same colour as its background, which nothing draws. An
+// 8 colour terminal has only pairs 0 to 63.
+func colourPair(fg, bg Colour) int {
+	if fg == defaultColour && bg == defaultColour {
+		return 0
+	}
+	if fg == defaultColour {
+		fg = white
+	}
+	if bg == defaultColour {
+		bg = black
+	}
+	if fg == bg {
+		return 0
+	}
+	if bg > fg {
+		bg--
+	}
+	return 1 + int(fg-1)*7 + int(bg-1)
+}
+
+func messageStyle(kind int) Style {
+	switch kind {
+	case dangerMessage:
+		return Style{fg: red, bold: true}
+	case successMessage:
+		return Style{fg: green}
+	}
+	return Style{}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestColour(t *testing.T) {
+	for _, ct := range cellTests {
+		c := ct.new()
+		if ct.repairs {
+			if c.(Drawable).Style() != damagedStyle {
+				t.Errorf("damaged %v is not red", kind(c))
+			}
+			setDamage(c, false)
+			if c.(Drawable).Style() == damagedStyle {
+				t.Errorf("working %v is red", kind(c))
+			}
+		}
+	}
+
+	// Conduits light up while they carry energy
+	level := new(Level)
+	level.x, level.y = 3, 1
+	level.Init()
+	level.cells[0][0], level.cells[1][0], level.cells[2][0] = new(PowerPlant), new(Conduit), new(Conduit)
+	level.energy.ProcessFlow(level.cells)
+	if !(level.StyleAt(1, 0) == liveStyle && level.StyleAt(0, 0) != liveStyle) {
+		t.Errorf("conduit not lit")
+	}
+	level.cells[0][0] = new(Floor)
+	level.energy.Invalidate(0, 0)
+	level.energy.ProcessFlow(level.cells)
+	if level.StyleAt(1, 0) == liveStyle {
+		t.Errorf("dead conduit lit")
+	}
+
+	// Every pair of colours has its own curses pair
+	pairs := make(map[int]bool)
+	for fg := black; fg <= white; fg++ {
+		for bg := black; bg <= white; bg++ {
+			p := colourPair(fg, bg)
+			if fg == bg {
+				if p != 0 {
+					t.Errorf("pair %v for %v on itself", p, fg)
+				}
+				continue
+			}
+			if !(p > 0 && p < 64 && !pairs[p]) {
+				t.Errorf("pair %v for %v on %v", p, fg, bg)
+			}
+			pairs[p] = true
+		}
+	}
+	if colourPair(defaultColour, defaultColour) != 0 {
+		t.Errorf("default is not pair 0")
+	}
+}
@@ -0,0 +1,74 @@
+//go:build curses
+// +build curses
+
+package main
+
+import (
+	"github.com/errnoh/gocurse/curses"
+)
+
+//////////////////// CURSES TERMINAL ////////////////////
+
+// The curses backend needs cgo and the ncurses headers, build with
+// -tags curses to include it.
+
+func init() {
+	terminals["curses"] = func() (Terminal, error) { return new(CursesTerminal), nil }
+}
+
+type CursesTerminal struct {
+	screen *curses.Window
+	colour bool
+}
+
+func (t *CursesTerminal) Start() bool {
+	// Initscr() initializes the terminal in curses mode.
+	t.screen, _ = curses.Initscr()
+	curses.Noecho()
+	curses.Cbreak()
+	t.screen.Keypad(true)
+	curses.Curs_set(0)
+	if curses.Has_colors() {
+		curses.Start_color()
+		for fg := black; fg <= white; fg++ {
+			for bg := black; bg <= white; bg++ {
+				if pair := colourPair(fg, bg); pair > 0 {
+					curses.Init_pair(pair, int(fg-1), int(bg-1))
+				}
+			}
+		}
+		t.colour = true
+	}
+	return t.colour
+}
+
+// Endwin must be called when done.
+func (t *CursesTerminal) Stop()            { curses.Endwin() }
+func (t *CursesTerminal) Size() (int, int) { return t.screen.Getmax() }
+func (t *CursesTerminal) Clear()           { t.screen.Clear() }
+func (t *CursesTerminal) Key() int         { return t.screen.Getch() }
+func (t *CursesTerminal) Put(x, y int, ch int32, st Style) {
+	t.screen.Addch(x, y, ch, t.attr(st))
+}
+func (t *CursesTerminal) Print(x, y int, s string, st Style) {
+	t.screen.Addstr(x, y, s, t.attr(st))
+}
+
+// attr turns a style into curses attributes, just the attributes on a
+// terminal without colour.
+func (t *CursesTerminal) attr(st Style) int32 {
+	a := curses.A_NORMAL
+	if st.bold {
+		a |= curses.A_BOLD
+	}
+	if st.dim {
+		a |= curses.A_DIM
+	}
+	if st.reverse {
+		a |= curses.A_REVERSE
+	}
+	if t.colour {
+		a |= curses.Color_pair(colourPair(st.fg, st.bg))
+	}
+	return a
+}
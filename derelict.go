@@ -1,15 +1,20 @@
 package main
 
 import (
-	"container/list"
+	"flag"
+	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"os"
+	"strings"
 	"time"
 )
 
 var Dlog *log.Logger
 
+// Where the game is saved on quitting
+var saveFilename string
+
 const (
 	NONE int = -1
 
@@ -28,10 +33,21 @@ const (
 )
 
 ////////////////////// AIR /////////////////////////
+
+// Air is a conserved quantity: each turn neighbouring cells the air flows
+// through exchange airFlowRate of the difference in their pressure, so the
+// total only changes where a cell's AirSinkSource adds or removes some.
+// airFlowRate must stay below 1/8 so no cell can give away more than it has
+// to its eight neighbours.
+const airFlowRate = 0.1
+
 type Air struct {
 	x, y   int
 	air    [][]float64
 	buffer [][]float64
+
+	// Running totals of air added by sources and removed by sinks
+	sourced, sunk float64
 }
 
 func (a *Air) Init(x, y int) {
@@ -44,31 +60,37 @@ func (a *Air) Init(x, y int) {
 	}
 }
 func (a *Air) ProcessFlow(cells [][]Cell) {
-	const ()
-	var total, nairs float64
+	Dlog.Println("-> processFlow")
+	for i := 0; i < a.x; i++ {
+		copy(a.buffer[i], a.air[i])
+	}
+	// Visit each neighbouring pair once: right, down and both right diagonals
+	neighbours := [][2]int{{1, -1}, {1, 0}, {1, 1}, {0, 1}}
 	for i := 0; i < a.x; i++ {
 		for j := 0; j < a.y; j++ {
-			if cells[i][j].AirFlows() {
-				total = 0
-				nairs = 0
-				Dlog.Printf("   processFlow cell: (%v, %v)\n", i, j)
-				for ii := -1; ii <= 1; ii++ {
-					for jj := -1; jj <= 1; jj++ {
-						if i+ii >= 0 && i+ii < a.x && j+jj >= 0 && j+jj < a.y {
-							if cells[i+ii][j+jj].AirFlows() {
-								total += a.air[i+ii][j+jj]
-								nairs++
-								Dlog.Printf("   processFlow (%v, %v), flows %v / %v\n", i+ii, j+jj, total, nairs)
-							}
-						}
-					}
+			if !cells[i][j].AirFlows() {
+				continue
+			}
+			for _, n := range neighbours {
+				ii, jj := i+n[0], j+n[1]
+				if ii < a.x && jj >= 0 && jj < a.y && cells[ii][jj].AirFlows() {
+					flow := airFlowRate * (a.air[i][j] - a.air[ii][jj])
+					a.buffer[i][j] -= flow
+					a.buffer[ii][jj] += flow
 				}
-				if nairs == 0 || total == 0 {
-					a.buffer[i][j] = cells[i][j].AirSinkSource(0)
+			}
+		}
+	}
+	for i := 0; i < a.x; i++ {
+		for j := 0; j < a.y; j++ {
+			if cells[i][j].AirFlows() {
+				change := cells[i][j].AirSinkSource(a.buffer[i][j])
+				if change > 0 {
+					a.sourced += change
 				} else {
-					a.buffer[i][j] = cells[i][j].AirSinkSource(total / nairs)
+					a.sunk -= change
 				}
-				Dlog.Printf("   processFlow (%v, %v) airs: %v, total: %v\n", i, j, nairs, total)
+				a.buffer[i][j] += change
 			}
 		}
 	}
@@ -78,63 +100,181 @@ func (a *Air) ProcessFlow(cells [][]Cell) {
 	Dlog.Println("<- processFlow")
 }
 
+// Total is all the air on the level.
+func (a *Air) Total() float64 {
+	total := 0.0
+	for i := 0; i < a.x; i++ {
+		for j := 0; j < a.y; j++ {
+			total += a.air[i][j]
+		}
+	}
+	return total
+}
+
 ////////////////////// ENERGY ////////////////////////
+
+// Cells that energy flows through are joined into networks of touching
+// cells. Each turn a network's supply is shared among its cells by demand, so
+// when there is not enough to go round every consumer gets the same fraction
+// of what it asked for. Any EnergyStores on the network soak up the surplus
+// or cover the shortfall. Networks are only worked out again around cells
+// that have changed, see Invalidate.
+
+const fullEnergy = 9.0 // Sensor reading of a network meeting all its demand
+
 type Energy struct {
 	x, y   int
-	energy [][]float64
+	energy [][]float64 // Sensor reading at each cell
+
+	built   bool       // Whether the networks have been worked out at all
+	net     [][]int    // Index into nets of each cell's network, -1 for none
+	nets    [][][2]int // Cells in each network, nil once broken up
+	live    int        // Networks in nets that are not nil
+	changed [][2]int   // Cells changed since the networks were worked out
 }
 
 func (e *Energy) Init(x, y int) {
 	e.x, e.y = x, y
 	e.energy = make([][]float64, x, x)
+	e.net = make([][]int, x, x)
 	for i := 0; i < x; i++ {
 		e.energy[i] = make([]float64, y, y)
+		e.net[i] = make([]int, y, y)
 	}
+	e.built = false
 }
-func (e *Energy) ProcessFlow(cells [][]Cell) {
-	tbd := list.New()
+
+// Invalidate notes that the cell at x, y has changed in a way that may join
+// or split networks, e.g. a conduit was built, salvaged or repaired.
+func (e *Energy) Invalidate(x, y int) {
+	e.changed = append(e.changed, [2]int{x, y})
+}
+
+// flood makes a new network of every cell joined to x, y
+func (e *Energy) flood(cells [][]Cell, x, y int) {
+	id := len(e.nets)
+	members := [][2]int{{x, y}}
+	e.net[x][y] = id
+	for k := 0; k < len(members); k++ {
+		c := members[k]
+		for i := c[0] - 1; i <= c[0]+1; i++ {
+			for j := c[1] - 1; j <= c[1]+1; j++ {
+				if i >= 0 && i < e.x && j >= 0 && j < e.y &&
+					e.net[i][j] < 0 && cells[i][j].EnergyFlows() {
+					e.net[i][j] = id
+					members = append(members, [2]int{i, j})
+				}
+			}
+		}
+	}
+	e.nets = append(e.nets, members)
+	e.live++
+}
+func (e *Energy) rebuild(cells [][]Cell) {
+	Dlog.Println("-> Energy.rebuild")
+	e.built, e.nets, e.live, e.changed = true, e.nets[:0], 0, nil
 	for i := 0; i < e.x; i++ {
 		for j := 0; j < e.y; j++ {
-			e.energy[i][j] = cells[i][j].EnergySinkSource(0)
-			if e.energy[i][j] > 0 {
-				tbd.PushBack([2]int{i, j})
-			}
+			e.net[i][j] = -1
+			e.energy[i][j] = 0
 		}
 	}
-	member := func(el [2]int, lst *list.List) bool {
-		for e := lst.Front(); e != nil; e = e.Next() {
-			a := e.Value.([2]int)
-			if a[0] == el[0] && a[1] == el[1] {
-				return true
+	for i := 0; i < e.x; i++ {
+		for j := 0; j < e.y; j++ {
+			if e.net[i][j] < 0 && cells[i][j].EnergyFlows() {
+				e.flood(cells, i, j)
 			}
 		}
-		return false
-	}
-
-	done := list.New()
-	var follow func(int, int)
-	follow = func(x, y int) {
-		for i := x - 1; i <= x+1; i++ {
-			for j := y - 1; j <= y+1; j++ {
-				if i >= 0 && i < e.x && j >= 0 && j < e.y {
-					if cells[i][j].EnergyFlows() && !member([2]int{i, j}, done) {
-						Dlog.Printf("Energy.ProcessFlows: (%v, %v)\n", i, j)
-						done.PushBack([2]int{i, j})
-						if e.energy[x][y] > e.energy[i][j] {
-							e.energy[i][j] = cells[i][j].EnergySinkSource(e.energy[x][y])
-							if e.energy[i][j] > 0 {
-								follow(i, j)
-							}
-						}
-					}
+	}
+	Dlog.Println("<- Energy.rebuild", e.live)
+}
+
+// update breaks up every network touching a changed cell and floods them
+// afresh, leaving the rest of the ship alone.
+func (e *Energy) update(cells [][]Cell) {
+	Dlog.Println("-> Energy.update", len(e.changed))
+	var loose [][2]int
+	for _, c := range e.changed {
+		for i := c[0] - 1; i <= c[0]+1; i++ {
+			for j := c[1] - 1; j <= c[1]+1; j++ {
+				if i < 0 || i >= e.x || j < 0 || j >= e.y || e.net[i][j] < 0 {
+					continue
+				}
+				id := e.net[i][j]
+				for _, m := range e.nets[id] {
+					e.net[m[0]][m[1]] = -1
+					e.energy[m[0]][m[1]] = 0
 				}
+				loose = append(loose, e.nets[id]...)
+				e.nets[id] = nil
+				e.live--
 			}
 		}
+		loose = append(loose, c)
+	}
+	e.changed = nil
+	for _, c := range loose {
+		if e.net[c[0]][c[1]] < 0 && cells[c[0]][c[1]].EnergyFlows() {
+			e.flood(cells, c[0], c[1])
+		}
 	}
-	for e := tbd.Front(); e != nil; e = e.Next() {
-		Dlog.Printf("Energy.ProcessFlows Source: (%v, %v)\n", e.Value.([2]int)[0], e.Value.([2]int)[1])
-		done.PushBack(e.Value)
-		follow(e.Value.([2]int)[0], e.Value.([2]int)[1])
+	// Don't let broken up networks pile up
+	if len(e.nets) > 2*e.live+16 {
+		e.rebuild(cells)
+	}
+	Dlog.Println("<- Energy.update", e.live)
+}
+
+func (e *Energy) ProcessFlow(cells [][]Cell) {
+	if !e.built {
+		e.rebuild(cells)
+	} else if len(e.changed) > 0 {
+		e.update(cells)
+	}
+	for _, members := range e.nets {
+		var supply, demand, room, available float64
+		for _, m := range members {
+			c := cells[m[0]][m[1]]
+			supply += c.EnergySupply()
+			demand += c.EnergyDemand()
+			if store, ok := c.(EnergyStore); ok {
+				if store.Discharging() {
+					available += store.Available()
+				} else {
+					room += store.ChargeRoom()
+				}
+			}
+		}
+		// Spare energy charges stores, a shortfall is drawn from them
+		stored, drawn := 0.0, 0.0
+		if supply > demand {
+			stored = math.Min(supply-demand, room)
+		} else {
+			drawn = math.Min(demand-supply, available)
+		}
+		met := 0.0
+		if demand > 0 {
+			met = (supply + drawn) / demand
+			if met > 1 {
+				met = 1
+			}
+		} else if supply+available > 0 {
+			met = 1
+		}
+		for _, m := range members {
+			c := cells[m[0]][m[1]]
+			c.EnergySupplied(c.EnergyDemand() * met)
+			e.energy[m[0]][m[1]] = fullEnergy * met
+			if store, ok := c.(EnergyStore); ok {
+				if store.Discharging() && available > 0 {
+					store.Charge(-drawn * store.Available() / available)
+				} else if !store.Discharging() && room > 0 {
+					store.Charge(stored * store.ChargeRoom() / room)
+				}
+				// The sensor shows how full a store is
+				e.energy[m[0]][m[1]] = fullEnergy * store.Level()
+			}
+		}
 	}
 }
 
@@ -148,6 +288,20 @@ type Level struct {
 	air   Air
 
 	energy Energy
+
+	rng *RNG // The game's random numbers, shared by everything on the level
+
+	events   []Event  // What happened this turn, see TakeEvents
+	breached [][]bool // Cells leaking into space last turn, see decompress
+
+	generation int // Bumped whenever a cell is replaced, see setCell
+}
+
+// setCell replaces the cell at x, y once the game is under way. Jobs started
+// before are lost, see Work.
+func (level *Level) setCell(x, y int, c Cell) {
+	level.cells[x][y] = c
+	level.generation++
 }
 
 func (level *Level) Init() {
@@ -161,15 +315,30 @@ func (level *Level) Init() {
 		}
 	}
 }
+
+// Atmosphere is the air held inside the ship, i.e. not in open space.
+func (level *Level) Atmosphere() float64 {
+	total := 0.0
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if _, space := level.cells[i][j].(*Vacuum); !space {
+				total += level.air.air[i][j]
+			}
+		}
+	}
+	return total
+}
 func (level *Level) Iterate() {
 	Dlog.Println("-> Level.Iterate")
 	level.air.ProcessFlow(level.cells)
 	level.energy.ProcessFlow(level.cells)
+	level.decompress()
 	Dlog.Println("<- Level.Iterate")
 }
 
 type Drawable interface {
 	Character() int32
+	Style() Style
 }
 
 ////////////////////// PLAYER /////////////////////////
@@ -193,9 +362,17 @@ type Player struct {
 	air_left, air_capacity float64
 	dead                   bool
 	left_ship              bool
+	escaped                bool // Left the derelict through the exit
 	helmet_on              bool
 
 	copper, steel int
+
+	stats    RunStats
+	upgrades map[string]int // Times each shipyard upgrade has been bought, by id
+	career   []RunRecord    // Derelicts left behind so far this campaign
+
+	job     *Job  // In hand or left unfinished, see Work
+	planned *Work // Rolled by the cell being acted on, see plan
 }
 
 func (p *Player) Init() {
@@ -212,6 +389,17 @@ func (p *Player) Init() {
 	p.air_left, p.air_capacity = 10.0, 10.0
 	p.helmet_on = true
 	p.dead = false
+	p.upgrades = make(map[string]int)
+}
+
+// Arrive puts the player at the exit of a new derelict, keeping everything
+// they carry.
+func (p *Player) Arrive(level *Level) {
+	p.x, p.y = level.exit_x, level.exit_y
+	p.left_ship, p.escaped, p.dead = false, false, false
+	p.sensor = noSensor
+	p.job = nil // Left behind on the last derelict
+	p.stats.Start(level)
 }
 func (p *Player) Move(to_x, to_y int) {
 	Dlog.Println("-> Move", to_x, to_y)
@@ -232,20 +420,54 @@ func (p *Player) Walk(dir_x, dir_y int, level *Level) bool {
 	return false
 }
 func (p *Player) Character() int32 { return '@' }
+
+const (
+	breathing    = 0.02 // Tank air used a turn with the helmet on
+	exposure     = 0.3  // Air lost a turn per unit below low pressure with the helmet off
+	sensorDrain  = 0.01 // Suit energy used a turn with a sensor on
+	suitRecharge = 0.01 // Suit energy gained a turn from each live cell nearby
+)
+
 func (p *Player) Iterate(level *Level) {
+	p.decompress(level)
 	if !p.left_ship && (level.exit_x != p.x || level.exit_y != p.y) {
 		p.left_ship = true
 	}
 
+	p.stats.turns++
+	tank := p.air_left
+
 	const med, low float64 = 6, 3
-	if level.air.air[p.x][p.y] < low {
-		p.air_left -= 0.1 / (1 + level.air.air[p.x][p.y])
-		/*
-			} else if level.air.air[p.x][p.y] >= low && level.air.air[p.x][p.y] < med {
-				// Do nothing, enough air to maintain
-		*/
-	} else if level.air.air[p.x][p.y] >= med {
-		p.air_left += level.air.air[p.x][p.y] / 50
+	ambient := level.air.air[p.x][p.y]
+	if ambient >= med {
+		// Rich air tops the tank up, helmet on or off
+		p.air_left += ambient / 50
+	} else if !p.helmet_on {
+		// Breathing the ship's air saves the tank, but thin air leaves you
+		// gasping and there's nothing to breathe in a vacuum
+		if ambient < low {
+			p.air_left -= exposure * (low - ambient)
+		}
+	} else if ambient < low {
+		p.air_left -= 0.1 / (1 + ambient)
+	} else {
+		p.air_left -= breathing
+	}
+
+	// Sensors run off the suit, which charges from live conduits nearby
+	if p.sensor != noSensor {
+		p.energy_left -= sensorDrain
+		if p.energy_left <= 0 {
+			p.energy_left = 0
+			p.sensor = noSensor
+		}
+	}
+	if p.nextToLiveConduit(level) {
+		p.energy_left = math.Min(p.energy_capcacity, p.energy_left+suitRecharge)
+	}
+
+	if p.air_left < tank {
+		p.stats.airUsed += tank - p.air_left
 	}
 
 	// Air limits
@@ -257,15 +479,33 @@ func (p *Player) Iterate(level *Level) {
 	}
 }
 
+// nextToLiveConduit reports whether the player is on or next to a conduit
+// carrying energy, not just any powered cell like a plant or battery.
+func (p *Player) nextToLiveConduit(level *Level) bool {
+	for i := p.x - 1; i <= p.x+1; i++ {
+		for j := p.y - 1; j <= p.y+1; j++ {
+			if i >= 0 && i < level.x && j >= 0 && j < level.y && level.liveConduit(i, j) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ToggleHelmet takes the helmet off or puts it back on, returning a message.
+func (p *Player) ToggleHelmet() string {
+	p.helmet_on = !p.helmet_on
+	if p.helmet_on {
+		return "You put your helmet on and breathe from your tank"
+	}
+	return "You take your helmet off and breathe the ship's air"
+}
+
+// Action acts on a cell next to the player, returning the turns it took.
+// Salvage, repairs and creation start a job instead, see Work.
 func (p *Player) Action(level *Level, ui UI, action_id int) (turns int) {
 	Dlog.Println("-> Player.Action")
-	abort := false
-	if action_id == NONE {
-		action_id, abort = ui.Menu("Choose an Action:",
-			[]string{"Salvage",
-				"Repair",
-				"Create"})
-	}
+	action_id, abort := chooseAction(ui, action_id)
 	Dlog.Println("   Player.Action: ", action_id, abort)
 	if abort {
 		Dlog.Println("-> Player.Action: false")
@@ -274,15 +514,65 @@ func (p *Player) Action(level *Level, ui UI, action_id int) (turns int) {
 	x, y, abort := ui.DirectionPrompt()
 	if abort {
 		return 0
-	} else if level.cells[p.x+x][p.y+y] != nil {
-		replacement := level.cells[p.x+x][p.y+y]
+	}
+	return p.actOn(level, ui, action_id, p.x+x, p.y+y)
+}
+
+// ActionAt is Action on the cell at tx, ty, e.g. picked in look mode. It has
+// to be within reach, except that anything visible can be activated.
+func (p *Player) ActionAt(level *Level, ui UI, action_id, tx, ty int, visible bool) int {
+	Dlog.Println("-> Player.ActionAt", tx, ty)
+	if !p.InReach(tx, ty) && !(action_id == ACTIVATE && visible) {
+		ui.Message("That is out of reach")
+		return 0
+	}
+	action_id, abort := chooseAction(ui, action_id)
+	if abort {
+		return 0
+	}
+	return p.actOn(level, ui, action_id, tx, ty)
+}
+
+// InReach reports whether the player can work on the cell at x, y: their
+// own or one next to it.
+func (p *Player) InReach(x, y int) bool {
+	return x >= p.x-1 && x <= p.x+1 && y >= p.y-1 && y <= p.y+1
+}
+
+// chooseAction asks which action to take if it is NONE
+func chooseAction(ui UI, action_id int) (int, bool) {
+	if action_id != NONE {
+		return action_id, false
+	}
+	return ui.Menu("Choose an Action:",
+		[]string{"Salvage",
+			"Repair",
+			"Create"})
+}
+
+func (p *Player) actOn(level *Level, ui UI, action_id, tx, ty int) (turns int) {
+	if tx < 0 || tx >= level.x || ty < 0 || ty >= level.y {
+		ui.Message("There is nothing there")
+		return 0
+	}
+	if (action_id == SALVAGE || action_id == CREATE) && tx == p.x && ty == p.y {
+		ui.Message("You cannot work on the square you are standing on")
+		return 0
+	}
+	if level.cells[tx][ty] != nil {
+		if p.resumeJob(level, ui, action_id, tx, ty) {
+			return 0
+		}
+		p.planned = nil
+		target := level.cells[tx][ty]
+		replacement := target
 		switch action_id {
 		case ACTIVATE:
-			turns = level.cells[p.x+x][p.y+y].Activate(ui)
+			turns = target.Activate(ui)
 		case SALVAGE:
-			turns, replacement = level.cells[p.x+x][p.y+y].Salvage(ui, p)
+			turns, replacement = target.Salvage(ui, p, level.rng)
 		case REPAIR:
-			turns, replacement = level.cells[p.x+x][p.y+y].Repair(ui, p)
+			turns, replacement = target.Repair(ui, p, level.rng)
 		case CREATE:
 			cell, abort := ui.Menu("Create what?",
 				[]string{"Floor", "Wall", "Conduit", "Wall/Conduit", "Door", "Door/Conduit"})
@@ -293,149 +583,103 @@ func (p *Player) Action(level *Level, ui UI, action_id int) (turns int) {
 			switch cell {
 			case FLOOR:
 				nc = new(Floor)
-				turns = nc.Create(ui, p)
 			case WALL:
 				nc = new(Wall)
-				turns = nc.Create(ui, p)
 			case CONDUIT:
+				nc = new(Conduit)
 			case WALL_CONDUIT:
+				nc = new(WallConduit)
 			case DOOR:
+				nc = new(Door)
 			case DOOR_CONDUIT:
+				nc = new(DoorConduit)
+			default:
+				return 0
+			}
+			if why := canBuild(nc, target); why != "" {
+				ui.Message(why)
+				return 0
 			}
+			turns = nc.Create(ui, p, level.rng)
 			if turns > 0 {
 				replacement = nc
 			}
 		}
-		level.cells[p.x+x][p.y+y] = replacement
+		if p.planned != nil {
+			// Takes effect when the job is done, the UI works it turn by turn
+			p.startJob(level, ui, tx, ty, target, replacement, turns)
+			return 0
+		}
+		if replacement != target {
+			level.setCell(tx, ty, replacement)
+		}
+		level.energy.Invalidate(tx, ty)
 	}
 
 	Dlog.Println("<- Player.Action: true")
 	return turns
 }
 
-func buildTestLevel(level *Level) {
-	x, y := 10, 2
-	// Floor
-	for i := 0; i < 31; i++ {
-		for j := 0; j < 20; j++ {
-			level.cells[x+i][y+j] = new(Floor)
-		}
-	}
-	// Outer walls
-	for i := 0; i < 31; i++ {
-		level.cells[x+i][y+0] = new(Wall)
-	}
-	for i := 0; i < 31; i++ {
-		level.cells[x+i][y+20] = new(Wall)
-	}
-	for i := 0; i < 20; i++ {
-		level.cells[x+0][y+i] = new(Wall)
-	}
-	for i := 0; i < 20; i++ {
-		level.cells[x+30][y+i] = new(Wall)
-	}
-
-	// Inner walls
-	for i := 0; i < 15; i++ {
-		level.cells[x+8][y+i] = new(Wall)
-	}
-	for i := 0; i < 18; i++ {
-		level.cells[x+i][y+14] = new(Wall)
-	}
-	for i := 15; i < 20; i++ {
-		level.cells[x+12][y+i] = new(Wall)
-	}
-	for i := 8; i < 18; i++ {
-		level.cells[x+i][y+8] = new(Wall)
-	}
-	for i := 0; i < 20; i++ {
-		level.cells[x+18][y+i] = new(Wall)
-	}
-	for i := 0; i < 20; i++ {
-		level.cells[x+21][y+i] = new(Wall)
-	}
-	for i := 21; i < 30; i++ {
-		level.cells[x+i][y+10] = new(Wall)
-	}
-
-	// Doors
-	level.cells[x+0][y+2] = new(Door)
-	level.cells[x+8][y+9] = new(Door)
-	level.cells[x+14][y+8] = new(Door)
-	level.cells[x+14][y+14] = new(Door)
-	level.cells[x+12][y+17] = new(Door)
-	level.cells[x+18][y+11] = new(Door)
-	level.cells[x+21][y+6] = new(Door)
-	level.cells[x+21][y+14] = new(Door)
-
-	// Power Plant
-	level.cells[x+26][y+3] = new(PowerPlant)
-	level.cells[x+27][y+3] = new(PowerPlant)
-	level.cells[x+26][y+4] = new(PowerPlant)
-	level.cells[x+27][y+4] = new(PowerPlant)
-	/*
-		level.cells[24][6].(*PowerPlant).damaged = false
-		level.cells[25][6].(*PowerPlant).damaged = false
-		level.cells[24][7].(*PowerPlant).damaged = false
-		level.cells[25][7].(*PowerPlant).damaged = false
-	*/
-
-	// Air Plant
-	level.cells[x+26][y+17] = new(AirPlant)
-	level.cells[x+27][y+17] = new(AirPlant)
-	level.cells[x+26][y+16] = new(AirPlant)
-	level.cells[x+27][y+16] = new(AirPlant)
-
-	// Conduits
-	level.cells[x+28][y+4] = new(Conduit)
-	level.cells[x+28][y+5] = new(Conduit)
-	level.cells[x+28][y+6] = new(Conduit)
-	level.cells[x+28][y+7] = new(Conduit)
-	level.cells[x+28][y+8] = new(Conduit)
-	level.cells[x+28][y+9] = new(Conduit)
-	level.cells[x+28][y+10] = new(WallConduit)
-	level.cells[x+28][y+11] = new(Conduit)
-	tmp := new(Conduit)
-	tmp.damaged = true
-	level.cells[x+28][y+12] = tmp
-	level.cells[x+28][y+13] = new(Conduit)
-	level.cells[x+28][y+14] = new(Conduit)
-	level.cells[x+28][y+15] = new(Conduit)
-	level.cells[x+28][y+16] = new(Conduit)
-
-	level.cells[0][5] = new(Wall)
-	level.cells[1][5] = new(Wall)
-	level.cells[0][7] = new(Wall)
-	level.cells[1][7] = new(Wall)
-	level.cells[1][6] = new(Door)
-	level.cells[0][6] = new(EntranceExit)
-	level.exit_x, level.exit_y = 0, 6
-
-}
-
 /////////////////// GAME MAIN ///////////////////
 type Game struct {
 	level  Level
 	player Player
 	ui     UI
+	rng    *RNG
 }
 
-func NewGame() Game {
+// NewGame starts a new game on the given level with the player at its exit
+func NewGame(level *Level, rng *RNG) Game {
 	var game Game
-	game.level.x, game.level.y = 69, 23
-	game.level.Init()
-
-	buildTestLevel(&game.level)
+	game.rng = rng
+	game.level = *level
+	game.level.rng = rng
 
 	game.player.Init()
-	game.player.x = 0
-	game.player.y = 6
+	game.player.Arrive(&game.level)
 
 	return game
 }
+
+// NextDerelict moves the player on to a freshly generated derelict, sized
+// and damaged for how far into the campaign they are.
+func (game *Game) NextDerelict() {
+	x, y, damage := derelictFor(game.player.stage())
+	game.level = *GenerateLevel(game.rng, x, y, damage)
+	game.player.Arrive(&game.level)
+	game.ui.SetLevel(&game.level)
+}
+
+// Play runs derelict after derelict, with a visit to the shipyard between
+// each, until the player dies, quits or heads home. Dying or heading home
+// ends the campaign; quitting leaves it to be resumed from the save file.
+func (game *Game) Play() {
+	for {
+		game.ui.Run()
+		if !game.player.escaped && !game.player.dead {
+			return
+		}
+		if game.player.dead || !Shipyard(game.ui, &game.player) {
+			break
+		}
+		game.NextDerelict()
+	}
+	game.ui.Report("The campaign is over", CampaignSummary(&game.player))
+}
 func main() {
-	// set a new random seed
-	rand.Seed(time.Now().UTC().UnixNano())
+	load := flag.Bool("load", false, "resume the game saved in the save file")
+	mapFile := flag.String("map", "", "play the derelict in this map file")
+	seed := flag.Int64("seed", 0, "random seed, 0 for a new one every run")
+	flag.StringVar(&saveFilename, "save", "derelict.sav", "save file")
+	flag.StringVar(&scoreFilename, "scores", "scores", "high score file")
+	flag.StringVar(&keymapFilename, "keys", "keys", "key bindings file")
+	flag.StringVar(&httpAddr, "http", "localhost:8080", "address to serve the game on with -ui web")
+	uiName := flag.String("ui", defaultTerminal(), "terminal to play on: "+strings.Join(terminalNames(), ", "))
+	flag.Parse()
+
+	if *seed == 0 {
+		*seed = time.Now().UTC().UnixNano()
+	}
 
 	/*
 		testLevel()
@@ -448,7 +692,51 @@ func main() {
 	}
 	Dlog = log.New(file, "DERELICT: ", 0)
 
-	game := NewGame()
-	game.ui = NewCursesUI(&game.level, &game.player)
-	game.ui.Run()
+	if keymap, err = LoadKeymapFile(keymapFilename); err != nil {
+		log.Fatal(err)
+	}
+
+	newTerminal, ok := terminals[*uiName]
+	if !ok {
+		log.Fatalf("No %q terminal, this build has %v", *uiName, strings.Join(terminalNames(), ", "))
+	}
+	term, err := newTerminal()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *load {
+		level, player, memory, err := LoadGameFile(saveFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		game := Game{level: *level, player: *player, rng: level.rng}
+		ui := NewTermUI(term, &game.level, &game.player)
+		ui.restoreMemory(memory)
+		game.ui = ui
+		play(&game)
+		fmt.Println("Seed:", game.rng.seed)
+		return
+	}
+
+	rng := NewRNG(*seed)
+	var level *Level
+	if *mapFile != "" {
+		if level, err = LoadMapFile(*mapFile); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		x, y, damage := derelictFor(1)
+		level = GenerateLevel(rng, x, y, damage)
+	}
+	game := NewGame(level, rng)
+	game.ui = NewTermUI(term, &game.level, &game.player)
+	play(&game)
+	fmt.Println("Seed:", rng.seed)
+}
+
+// play runs the game, putting the terminal back however it ends
+func play(game *Game) {
+	defer game.ui.Close()
+	game.Play()
 }
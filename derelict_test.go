@@ -0,0 +1,201 @@
+package main
+
+import (
+	"io"
+	"log"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Dlog = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+func TestAir(t *testing.T) {
+	const near = 1e-6
+	// A sealed room neither gains nor loses air however it is spread
+	level := new(Level)
+	level.x, level.y = 7, 5
+	level.Init()
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if i == 0 || j == 0 || i == level.x-1 || j == level.y-1 {
+				level.cells[i][j] = new(Wall)
+			} else {
+				level.cells[i][j] = new(Floor)
+			}
+		}
+	}
+	level.air.air[1][1] = 50
+	for i := 0; i < 100; i++ {
+		level.air.ProcessFlow(level.cells)
+	}
+	if math.Abs(level.Atmosphere()-50) >= near {
+		t.Errorf("sealed room has %v air, not 50", level.Atmosphere())
+	}
+	if math.Abs(level.air.air[1][1]-level.air.air[5][3]) >= 0.1 {
+		t.Errorf("sealed room did not even out")
+	}
+
+	// A breach to space loses exactly what flows out
+	level.cells[6][2] = new(Vacuum)
+	before := level.air.Total()
+	for i := 0; i < 20; i++ {
+		level.air.ProcessFlow(level.cells)
+	}
+	if level.air.Total() >= before {
+		t.Errorf("breach lost no air")
+	}
+	if math.Abs(before-level.air.sunk-level.air.Total()) >= near {
+		t.Errorf("breach lost %v but recorded %v", before-level.air.Total(), level.air.sunk)
+	}
+
+	// A powered air plant adds what it says it does, up to its pressure
+	level.cells[6][2] = new(Wall)
+	plant := &AirPlant{energy: 9}
+	level.cells[3][2] = plant
+	before = level.air.Total()
+	for i := 0; i < 1000; i++ {
+		level.air.ProcessFlow(level.cells)
+	}
+	if math.Abs(before+level.air.sourced-level.air.Total()) >= near {
+		t.Errorf("plant made %v but recorded %v", level.air.Total()-before, level.air.sourced)
+	}
+	if !(level.air.air[1][1] > airPlantPressure-0.1 && level.air.air[1][1] <= airPlantPressure+near) {
+		t.Errorf("plant filled the room to %v", level.air.air[1][1])
+	}
+}
+
+func TestEnergy(t *testing.T) {
+	// P-~-AA with the player below the burned out conduit
+	level := new(Level)
+	level.x, level.y = 6, 2
+	level.Init()
+	level.rng = NewRNG(1)
+	row := []Cell{new(PowerPlant), new(Conduit), &Conduit{damaged: true}, new(Conduit), new(AirPlant), new(AirPlant)}
+	for i, c := range row {
+		level.cells[i][0] = c
+		level.cells[i][1] = new(Floor)
+	}
+	player := new(Player)
+	player.Init()
+	player.x, player.y = 2, 1
+	player.steel, player.copper = 1000, 1000
+	ui := NewHeadlessUI(level, player)
+	plant := row[4].(*AirPlant)
+
+	level.energy.ProcessFlow(level.cells)
+	if plant.energy != 0 {
+		t.Errorf("powered through a burned out conduit")
+	}
+	if level.energy.energy[1][0] != fullEnergy {
+		t.Errorf("conduit next to plant reads %v", level.energy.energy[1][0])
+	}
+
+	// Repairing the conduit joins the networks
+	ui.Script(DirectionAnswer(0, -1))
+	act(level, player, ui, REPAIR)
+	level.energy.ProcessFlow(level.cells)
+	if plant.energy != airPlantDemand {
+		t.Errorf("repaired network gave the air plant %v", plant.energy)
+	}
+	if level.energy.energy[5][0] != fullEnergy {
+		t.Errorf("air plant reads %v", level.energy.energy[5][0])
+	}
+
+	// Not enough to go round, everyone gets the same share
+	level.cells[3][0] = new(AirPlant)
+	level.cells[2][1] = new(AirPlant)
+	level.energy.Invalidate(3, 0)
+	level.energy.Invalidate(2, 1)
+	level.energy.ProcessFlow(level.cells)
+	share := powerPlantSupply / (4 * airPlantDemand)
+	if math.Abs(plant.energy-airPlantDemand*share) >= 1e-9 {
+		t.Errorf("short network gave %v not %v", plant.energy, airPlantDemand*share)
+	}
+	if math.Abs(level.energy.energy[1][0]-fullEnergy*share) >= 1e-9 {
+		t.Errorf("short network reads %v", level.energy.energy[1][0])
+	}
+	level.cells[3][0] = new(Conduit)
+	level.cells[2][1] = new(Floor)
+	level.energy.Invalidate(3, 0)
+	level.energy.Invalidate(2, 1)
+
+	// Salvaging the conduit splits them again
+	ui.Script(DirectionAnswer(0, -1))
+	act(level, player, ui, SALVAGE)
+	level.energy.ProcessFlow(level.cells)
+	if !(plant.energy == 0 && level.energy.energy[3][0] == 0) {
+		t.Errorf("powered after the conduit was salvaged")
+	}
+	if level.energy.live != 2 {
+		t.Errorf("%v networks not 2", level.energy.live)
+	}
+}
+
+func TestSuit(t *testing.T) {
+	level, player, _ := testBench(new(Floor))
+	player.left_ship = true
+	breathe := func(air float64, turns int) float64 {
+		before := player.air_left
+		for i := 0; i < turns; i++ {
+			level.air.air[player.x][player.y] = air
+			player.Iterate(level)
+		}
+		return player.air_left - before
+	}
+
+	// With the helmet on the tank runs down in breathable but thin air
+	if breathe(4, 10) >= 0 {
+		t.Errorf("helmet on used no tank air")
+	}
+	// Off, the same air costs nothing from the tank
+	player.ToggleHelmet()
+	if breathe(4, 10) != 0 {
+		t.Errorf("helmet off used tank air")
+	}
+	// And rich air tops it up just as well as with the helmet on
+	player.air_left = 1
+	off := breathe(9, 10)
+	player.ToggleHelmet()
+	player.air_left = 1
+	if on := breathe(9, 10); !(off > 0 && off >= on) {
+		t.Errorf("rich air refilled %v with the helmet off, %v with it on", off, on)
+	}
+	player.ToggleHelmet()
+	// But in a vacuum it's soon fatal
+	breathe(0, 20)
+	if !player.dead {
+		t.Errorf("survived a vacuum without a helmet")
+	}
+
+	// Sensors drain the suit until they shut off
+	level, player, _ = testBench(new(Floor))
+	player.sensor = pressureSensor
+	turns := 0
+	for ; player.sensor != noSensor && turns < 1000; turns++ {
+		level.air.air[player.x][player.y] = 9
+		player.Iterate(level)
+	}
+	if !(player.energy_left == 0 && turns == int(math.Ceil(player.energy_capcacity/sensorDrain))) {
+		t.Errorf("sensor ran %v turns leaving %v", turns, player.energy_left)
+	}
+
+	// Powered cells that aren't conduits don't recharge it
+	level.cells[1][0] = new(Battery)
+	level.energy.energy[1][0] = fullEnergy
+	player.Iterate(level)
+	if player.energy_left != 0 {
+		t.Errorf("recharged next to a battery")
+	}
+
+	// Live conduits do, once a turn however many there are
+	level.cells[0][0], level.cells[1][0] = new(Conduit), new(Conduit)
+	level.energy.energy[0][0] = fullEnergy
+	player.Iterate(level)
+	if player.energy_left != suitRecharge {
+		t.Errorf("recharged %v next to two live conduits", player.energy_left)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+////////////////////// FIELD OF VIEW /////////////////////////
+
+// FieldOfView calls see for every cell within radius of ox, oy that can be
+// seen from there, judged by Cell.SeePast. It uses symmetric shadowcasting:
+// if one open cell can see another, the other can see it too, and walls are
+// seen whole rather than in patches. Each quarter of the view around the
+// origin is scanned row by row outwards, narrowing the visible arc at every
+// cell that blocks sight. Slopes are kept as fractions so the result does not
+// depend on rounding.
+func FieldOfView(cells [][]Cell, ox, oy, radius int, see func(x, y int)) {
+	see(ox, oy)
+	for q := 0; q < 4; q++ {
+		f := fov{cells, ox, oy, radius, q, see}
+		f.scan(1, slope{-1, 1}, slope{1, 1})
+	}
+}
+
+// A slope is num/den with den > 0
+type slope struct{ num, den int }
+
+type fov struct {
+	cells    [][]Cell
+	ox, oy   int
+	radius   int
+	quadrant int // North, east, south, west
+	see      func(x, y int)
+}
+
+// cell turns depth and column in the quadrant into level coordinates
+func (f *fov) cell(depth, col int) (int, int) {
+	switch f.quadrant {
+	case 0:
+		return f.ox + col, f.oy - depth
+	case 1:
+		return f.ox + depth, f.oy + col
+	case 2:
+		return f.ox + col, f.oy + depth
+	}
+	return f.ox - depth, f.oy + col
+}
+
+// open reports whether the cell at x, y can be seen past, off the level
+// counts as blocked.
+func (f *fov) open(x, y int) bool {
+	return x >= 0 && x < len(f.cells) && y >= 0 && y < len(f.cells[x]) &&
+		f.cells[x][y] != nil && f.cells[x][y].SeePast()
+}
+
+func (f *fov) reveal(x, y int) {
+	dx, dy := x-f.ox, y-f.oy
+	if x >= 0 && x < len(f.cells) && y >= 0 && y < len(f.cells[x]) && dx*dx+dy*dy <= f.radius*f.radius {
+		f.see(x, y)
+	}
+}
+
+// scan looks along the row depth away from the origin between the start and
+// end slopes, then on to the rows beyond it through every gap.
+func (f *fov) scan(depth int, start, end slope) {
+	if depth > f.radius {
+		return
+	}
+	// Columns whose centres lie within the slopes, ties round inwards
+	min := floorDiv(2*depth*start.num+start.den, 2*start.den)
+	max := -floorDiv(-(2*depth*end.num - end.den), 2*end.den)
+	wasOpen, first := false, true
+	for col := min; col <= max; col++ {
+		x, y := f.cell(depth, col)
+		isOpen := f.open(x, y)
+		// Walls are shown if any of them is lit, open cells only if their
+		// centre is, which is what makes it symmetric
+		if !isOpen || (col*start.den >= depth*start.num && col*end.den <= depth*end.num) {
+			f.reveal(x, y)
+		}
+		if !first && !wasOpen && isOpen {
+			start = slope{2*col - 1, 2 * depth}
+		}
+		if !first && wasOpen && !isOpen {
+			f.scan(depth+1, start, slope{2*col - 1, 2 * depth})
+		}
+		wasOpen, first = isOpen, false
+	}
+	if wasOpen {
+		f.scan(depth+1, start, end)
+	}
+}
+
+// floorDiv is a / b rounded down, for b > 0
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return -((-a + b - 1) / b)
+	}
+	return a / b
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFieldOfView(t *testing.T) {
+	visible := func(level *Level, x, y, radius int) map[[2]int]bool {
+		seen := make(map[[2]int]bool)
+		FieldOfView(level.cells, x, y, radius, func(i, j int) { seen[[2]int{i, j}] = true })
+		return seen
+	}
+
+	// Open space shows everything in range, a wall hides what is behind it
+	level, _, _ := testBench(new(Floor))
+	level.x, level.y = 9, 9
+	level.Init()
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			level.cells[i][j] = new(Floor)
+		}
+	}
+	seen := visible(level, 4, 4, 3)
+	if len(seen) != 29 {
+		t.Errorf("open space showed %v cells not 29", len(seen))
+	}
+	level.cells[5][4] = new(Wall)
+	seen = visible(level, 4, 4, 3)
+	if !(seen[[2]int{5, 4}] && !seen[[2]int{6, 4}] && !seen[[2]int{7, 4}]) {
+		t.Errorf("saw through a wall")
+	}
+	if !(seen[[2]int{6, 2}] && seen[[2]int{6, 6}]) {
+		t.Errorf("wall hid too much")
+	}
+
+	// Whatever one open cell sees sees it back
+	for seed := int64(1); seed <= 3; seed++ {
+		level := GenerateLevel(NewRNG(seed), 40, 20, 0.2)
+		for x := 1; x < level.x; x += 3 {
+			for y := 1; y < level.y; y += 3 {
+				if !level.cells[x][y].SeePast() {
+					continue
+				}
+				for c := range visible(level, x, y, 8) {
+					if level.cells[c[0]][c[1]].SeePast() && !visible(level, c[0], c[1], 8)[[2]int{x, y}] {
+						t.Errorf("seed %v %v,%v sees %v,%v but not back", seed, x, y, c[0], c[1])
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+////////////////////// HEADLESS UI /////////////////////////
+
+// An Answer is a scripted reply to the next prompt a HeadlessUI is shown.
+type Answer struct {
+	option  int  // Menu
+	x, y    int  // DirectionPrompt
+	yes     bool // YesNoPrompt
+	aborted bool
+}
+
+func MenuAnswer(option int) Answer    { return Answer{option: option} }
+func DirectionAnswer(x, y int) Answer { return Answer{x: x, y: y} }
+func YesNoAnswer(yes bool) Answer     { return Answer{yes: yes} }
+func AbortAnswer() Answer             { return Answer{aborted: true} }
+
+// HeadlessUI implements UI without a terminal. Prompts are answered from a
+// queue of scripted Answers and every message is recorded, so the game can be
+// driven and checked by code.
+type HeadlessUI struct {
+	level  *Level
+	player *Player
+
+	answers  []Answer
+	messages []string
+	kinds    []int // Of each message
+	prompts  []string
+	reports  [][]string
+}
+
+func NewHeadlessUI(level *Level, player *Player, answers ...Answer) *HeadlessUI {
+	ui := new(HeadlessUI)
+	ui.level = level
+	ui.player = player
+	ui.answers = answers
+	return ui
+}
+
+// Script queues more answers after any still waiting.
+func (ui *HeadlessUI) Script(answers ...Answer) { ui.answers = append(ui.answers, answers...) }
+
+// next pops the next answer, aborting any prompt that was not scripted.
+func (ui *HeadlessUI) next(prompt string) Answer {
+	ui.prompts = append(ui.prompts, prompt)
+	if len(ui.answers) == 0 {
+		Dlog.Println("   HeadlessUI: unscripted prompt:", prompt)
+		return AbortAnswer()
+	}
+	a := ui.answers[0]
+	ui.answers = ui.answers[1:]
+	return a
+}
+
+// Run does nothing: there is no one to play, whoever scripts the UI drives
+// the game through Player and Level directly.
+func (ui *HeadlessUI) Run()                  {}
+func (ui *HeadlessUI) SetLevel(level *Level) { ui.level = level }
+func (ui *HeadlessUI) Close()                {}
+func (ui *HeadlessUI) Message(s string)      { ui.Notify(infoMessage, s) }
+func (ui *HeadlessUI) Notify(kind int, s string) {
+	Dlog.Println("   HeadlessUI.Message:", kind, s)
+	ui.messages = append(ui.messages, s)
+	ui.kinds = append(ui.kinds, kind)
+}
+func (ui *HeadlessUI) Menu(title string, options []string) (int, bool) {
+	a := ui.next(title)
+	if a.option < 0 || a.option >= len(options) {
+		return a.option, true
+	}
+	return a.option, a.aborted
+}
+func (ui *HeadlessUI) DirectionPrompt() (int, int, bool) {
+	a := ui.next("Which Direction?")
+	return a.x, a.y, a.aborted
+}
+func (ui *HeadlessUI) YesNoPrompt(message string) (bool, bool) {
+	a := ui.next(message)
+	return a.yes, a.aborted
+}
+
+func (ui *HeadlessUI) Report(title string, lines []string) {
+	ui.reports = append(ui.reports, append([]string{title}, lines...))
+}
+
+// LastMessage is the most recent message, or "" if there have been none.
+func (ui *HeadlessUI) LastMessage() string {
+	if len(ui.messages) == 0 {
+		return ""
+	}
+	return ui.messages[len(ui.messages)-1]
+}
+
+// Messages returns and forgets everything said so far.
+func (ui *HeadlessUI) Messages() []string {
+	m := ui.messages
+	ui.messages, ui.kinds = nil, nil
+	return m
+}
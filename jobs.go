@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+)
+
+////////////////////// JOBS /////////////////////////
+
+// Salvage, repairs and creation take many turns. Starting one gives the
+// player a Job that is worked a turn at a time and only takes effect once it
+// is finished. Danger interrupts it: the player can carry on, or leave it and
+// come back later to pick up where they left off.
+
+// Work is what a job does when it is finished.
+type Work struct {
+	action        int    // SALVAGE, REPAIR or CREATE
+	steel, copper int    // Gained by salvage, used by repairs and creation
+	name          string // Of the cell worked on or created
+}
+
+type Job struct {
+	work        Work
+	x, y        int
+	cell        Cell // Worked on
+	generation  int  // Of the level when started, the job is lost if a cell is replaced since
+	result      Cell // Replaces cell when finished, nil to leave it
+	turns, done int
+	active      bool // Being worked, false once interrupted
+}
+
+func (j *Job) String() string {
+	switch j.work.action {
+	case SALVAGE:
+		return "salvaging the " + j.work.name
+	case REPAIR:
+		return "repairing the " + j.work.name
+	}
+	return "building a " + j.work.name
+}
+
+// plan is called by the generic actions with the work they have rolled, it
+// becomes a job when Action starts it.
+func (p *Player) plan(w Work) { p.planned = &w }
+
+// shortOf names the materials the player has too little of for work using
+// st steel and cu copper, "" if they have enough. Only the shipyard spends
+// them otherwise and no job outlasts its derelict, so what the player can
+// afford when a job starts they can when it finishes.
+func (p *Player) shortOf(st, cu int) string {
+	switch {
+	case p.steel < st && p.copper < cu:
+		return "steel and copper"
+	case p.steel < st:
+		return "steel"
+	case p.copper < cu:
+		return "copper"
+	}
+	return ""
+}
+
+// startJob makes the planned work the player's job, giving up any other.
+func (p *Player) startJob(level *Level, ui UI, x, y int, cell, result Cell, turns int) {
+	if p.job != nil {
+		ui.Message(fmt.Sprintf("You give up %v", p.job))
+	}
+	if result == cell {
+		result = nil
+	}
+	p.job = &Job{*p.planned, x, y, cell, level.generation, result, turns, 0, true}
+	p.planned = nil
+	ui.Message(fmt.Sprintf("You start %v, it will take %v turns", p.job, turns))
+}
+
+// resumeJob picks the player's job back up if it is action on the cell at
+// x, y, returning whether it did.
+func (p *Player) resumeJob(level *Level, ui UI, action, x, y int) bool {
+	j := p.job
+	if j == nil || j.active || j.work.action != action ||
+		j.x != x || j.y != y || j.generation != level.generation {
+		return false
+	}
+	j.active = true
+	ui.Message(fmt.Sprintf("You resume %v, %v turns to go", j, j.turns-j.done))
+	return true
+}
+
+// Working reports whether the player is busy with a job.
+func (p *Player) Working() bool { return p.job != nil && p.job.active }
+
+// Watch is what the player keeps an eye on while working.
+type Watch struct {
+	ambient, tank float64
+}
+
+const (
+	airRushing = 0.5  // Fall in the air around the player in a turn that means a breach
+	tankLow    = 0.25 // Fraction of the tank left worth a warning
+	thinAir    = 3.0  // Too little air to breathe with the helmet off
+)
+
+func (p *Player) Watch(level *Level) Watch {
+	return Watch{level.air.air[p.x][p.y], p.air_left}
+}
+
+// danger says what has happened since before that should stop work, or ""
+func (p *Player) danger(level *Level, before Watch) string {
+	now := p.Watch(level)
+	low := tankLow * p.air_capacity
+	switch {
+	case before.ambient-now.ambient > airRushing:
+		return "The air around you is rushing away!"
+	case p.helmet_on && before.tank >= low && now.tank < low:
+		return "Your air tank is running low!"
+	case !p.helmet_on && before.ambient >= thinAir && now.ambient < thinAir:
+		return "The air is getting too thin to breathe!"
+	}
+	return ""
+}
+
+// Work puts a turn into the player's job, finishing it if that was the
+// last. before is how things were at the start of the turn, if it has become
+// dangerous since the player is asked whether to carry on.
+func (p *Player) Work(level *Level, ui UI, before Watch) {
+	j := p.job
+	if level.generation != j.generation {
+		ui.Message(fmt.Sprintf("You stop %v, there is nothing left to work on", j))
+		p.job = nil
+		return
+	}
+	if !p.InReach(j.x, j.y) {
+		j.active = false
+		ui.Notify(dangerMessage, fmt.Sprintf("You are torn away from %v with %v turns to go", j, j.turns-j.done))
+		return
+	}
+	j.done++
+	if j.done >= j.turns {
+		p.finishJob(level, ui)
+		return
+	}
+	if why := p.danger(level, before); why != "" {
+		yes, aborted := ui.YesNoPrompt(fmt.Sprintf("%v Keep %v?", why, j))
+		if aborted || !yes {
+			j.active = false
+			ui.Message(fmt.Sprintf("You stop %v with %v turns to go", j, j.turns-j.done))
+		}
+	}
+}
+
+func (p *Player) finishJob(level *Level, ui UI) {
+	j := p.job
+	p.job = nil
+	st, cu := j.work.steel, j.work.copper
+	switch j.work.action {
+	case SALVAGE:
+		p.steel += st
+		p.copper += cu
+		p.stats.steel += st
+		p.stats.copper += cu
+		if st == 0 && cu == 0 {
+			ui.Message(fmt.Sprintf("You fail to salvage any useful metals in %v turns", j.turns))
+		} else if cu == 0 {
+			ui.Notify(successMessage, fmt.Sprintf("You salvage %v steel in %v turns", st, j.turns))
+		} else if st == 0 {
+			ui.Notify(successMessage, fmt.Sprintf("You salvage %v copper in %v turns", cu, j.turns))
+		} else {
+			ui.Notify(successMessage, fmt.Sprintf("You salvage %v steel and %v copper in %v turns", st, cu, j.turns))
+		}
+	case REPAIR, CREATE:
+		p.steel -= st
+		p.copper -= cu
+		if j.work.action == REPAIR {
+			setDamage(j.cell, false)
+			p.stats.repaired++
+			ui.Notify(successMessage, fmt.Sprintf("Used %v steel and %v copper to repair the %v in %v turns",
+				st, cu, j.work.name, j.turns))
+		} else {
+			p.stats.created++
+			ui.Notify(successMessage, fmt.Sprintf("Used %v steel and %v copper to create a %v section in %v turns",
+				st, cu, j.work.name, j.turns))
+		}
+	}
+	if j.result != nil {
+		level.setCell(j.x, j.y, j.result)
+	}
+	level.energy.Invalidate(j.x, j.y)
+}
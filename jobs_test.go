@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJobs(t *testing.T) {
+	level, player, ui := testBench(new(Wall), DirectionAnswer(1, 0))
+	level.air.air[0][0] = 9
+	steel := player.steel
+	if !(player.Action(level, ui, SALVAGE) == 0 && player.Working()) {
+		t.Errorf("salvage did not start a job")
+	}
+	job := player.job
+	if job.turns <= 1 {
+		t.Errorf("salvage takes %v turns", job.turns)
+	}
+	if !(kind(level.cells[1][0]) == "Wall" && player.steel == steel) {
+		t.Errorf("salvage took effect at once")
+	}
+
+	// A breach interrupts, stopping keeps the progress
+	before := player.Watch(level)
+	level.air.air[0][0] = 0
+	ui.Script(YesNoAnswer(false))
+	player.Work(level, ui, before)
+	if !(!player.Working() && player.job == job && job.done == 1) {
+		t.Errorf("breach left job %v done %v", player.job, job.done)
+	}
+	if !(len(ui.prompts) > 0 && strings.Contains(ui.prompts[len(ui.prompts)-1], "rushing")) {
+		t.Errorf("breach prompted %v", ui.prompts)
+	}
+
+	// Carrying on through danger keeps working
+	level2, player2, ui2 := testBench(new(Wall), DirectionAnswer(1, 0))
+	player2.Action(level2, ui2, SALVAGE)
+	player2.air_left = player2.air_capacity * tankLow / 2
+	ui2.Script(YesNoAnswer(true))
+	player2.Work(level2, ui2, Watch{0, player2.air_capacity})
+	if !(player2.Working() && len(ui2.prompts) == 2) {
+		t.Errorf("low tank did not ask to carry on")
+	}
+
+	// Saved and loaded unfinished
+	var buf bytes.Buffer
+	memory := Memory{mapCache: [][]int32{make([]int32, 1), make([]int32, 1)}, seen: [][]bool{make([]bool, 1), make([]bool, 1)}}
+	if err := SaveGame(&buf, level, player, memory); err != nil {
+		t.Fatal(err)
+	}
+	level, player, _, err := LoadGame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(player.job != nil && player.job.done == 1 && player.job.turns == job.turns &&
+		player.job.cell == level.cells[1][0] && kind(player.job.result) == "Floor") {
+		t.Errorf("loaded job %+v", player.job)
+	}
+	ui = NewHeadlessUI(level, player)
+
+	// Salvaging the same cell picks it back up without rolling again
+	draws := level.rng.src.draws
+	ui.Script(DirectionAnswer(1, 0))
+	turns := act(level, player, ui, SALVAGE)
+	if turns != job.turns-1 {
+		t.Errorf("resumed job took %v more turns of %v", turns, job.turns)
+	}
+	if level.rng.src.draws != draws {
+		t.Errorf("resuming rolled again")
+	}
+	if !(kind(level.cells[1][0]) == "Floor" && player.steel-steel == job.work.steel) {
+		t.Errorf("finished salvage left %v and %v steel", kind(level.cells[1][0]), player.steel-steel)
+	}
+
+	// A job is lost if its cell goes
+	level, player, ui = testBench(&Wall{damaged: true}, DirectionAnswer(1, 0))
+	player.Action(level, ui, REPAIR)
+	level.setCell(1, 0, new(Floor))
+	player.Work(level, ui, player.Watch(level))
+	if !(player.job == nil && player.stats.repaired == 0) {
+		t.Errorf("repaired a wall that was gone")
+	}
+
+	// Even if what replaces it is the same kind of cell
+	level, player, ui = testBench(new(Floor), DirectionAnswer(1, 0), YesNoAnswer(true))
+	player.Action(level, ui, SALVAGE)
+	player.job.active = false
+	level.setCell(1, 0, new(Floor))
+	ui.Script(DirectionAnswer(1, 0), YesNoAnswer(true))
+	player.Action(level, ui, SALVAGE)
+	if !(player.job != nil && player.job.done == 0 && strings.Contains(ui.LastMessage(), "You start")) {
+		t.Errorf("resumed salvaging a floor that was replaced: %v", ui.LastMessage())
+	}
+}
+
+func TestArrive(t *testing.T) {
+	// A job left unfinished stays on the derelict it was started on
+	level, player, ui := testBench(new(Floor), DirectionAnswer(1, 0), YesNoAnswer(true))
+	player.Action(level, ui, SALVAGE)
+	player.job.active = false
+	level, _, ui = testBench(&Wall{damaged: true}, DirectionAnswer(1, 0))
+	player.Arrive(level)
+	if player.job != nil {
+		t.Errorf("arrived still %v", player.job)
+	}
+	ui.player = player
+	turns := act(level, player, ui, SALVAGE)
+	if !(turns > 0 && kind(level.cells[1][0]) == "Floor") {
+		t.Errorf("salvaging the wall took %v turns and left %v", turns, kind(level.cells[1][0]))
+	}
+}
+
+func TestAfford(t *testing.T) {
+	// Building without the materials is refused before any work starts
+	level, player, ui := testBench(new(Vacuum), DirectionAnswer(1, 0), MenuAnswer(WALL_CONDUIT))
+	player.steel, player.copper = 0, 0
+	turns := act(level, player, ui, CREATE)
+	if !(turns == 0 && player.job == nil && kind(level.cells[1][0]) == "Vacuum") {
+		t.Errorf("built without materials in %v turns", turns)
+	}
+	if ui.LastMessage() != "You do not have enough steel and copper to build a wall conduit" {
+		t.Errorf("refused with %q", ui.LastMessage())
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+////////////////////// KEY BINDINGS /////////////////////////
+
+// The keymap file binds keys to commands, one "<key> <command>" per line,
+// on top of the default bindings. Blank lines and lines starting with '#'
+// are ignored. A key is a single character, one of the names in keyNames or
+// code:<n> for any other key code; binding a key to "none" unbinds it.
+var keymapFilename string
+
+// Commands a key can be bound to
+const (
+	noCommand = iota
+	moveWest
+	moveEast
+	moveSouth
+	moveNorth
+	moveNorthEast
+	moveNorthWest
+	moveSouthWest
+	moveSouthEast
+	moveHere // Only means anything as a direction
+	actionMenu
+	createCommand
+	repairCommand
+	salvageCommand
+	activateCommand
+	pressureCommand
+	energyCommand
+	helmetCommand
+	lookCommand
+	logCommand
+	debugCommand
+	helpCommand
+	quitCommand
+	maxCommand
+)
+
+var commandInfo = [maxCommand]struct {
+	name   string // In the keymap file
+	help   string
+	dx, dy int // For the moves
+}{
+	noCommand:       {"none", "", 0, 0},
+	moveWest:        {"west", "Move west", -1, 0},
+	moveEast:        {"east", "Move east", +1, 0},
+	moveSouth:       {"south", "Move south", 0, +1},
+	moveNorth:       {"north", "Move north", 0, -1},
+	moveNorthEast:   {"northeast", "Move north east", +1, -1},
+	moveNorthWest:   {"northwest", "Move north west", -1, -1},
+	moveSouthWest:   {"southwest", "Move south west", -1, +1},
+	moveSouthEast:   {"southeast", "Move south east", +1, +1},
+	moveHere:        {"here", "Here (directions)", 0, 0},
+	actionMenu:      {"menu", "Action menu", 0, 0},
+	createCommand:   {"create", "Create", 0, 0},
+	repairCommand:   {"repair", "Repair", 0, 0},
+	salvageCommand:  {"salvage", "Salvage", 0, 0},
+	activateCommand: {"activate", "Activate", 0, 0},
+	pressureCommand: {"pressure", "Pressure sensor", 0, 0},
+	energyCommand:   {"energy", "Energy sensor", 0, 0},
+	helmetCommand:   {"helmet", "Helmet off/on", 0, 0},
+	lookCommand:     {"look", "Look mode", 0, 0},
+	logCommand:      {"log", "Message log", 0, 0},
+	debugCommand:    {"debug", "Debug overlays", 0, 0},
+	helpCommand:     {"help", "This help", 0, 0},
+	quitCommand:     {"quit", "Quit", 0, 0},
+}
+
+func isMove(command int) bool { return command >= moveWest && command <= moveHere }
+
+// Key codes beyond plain characters are the ones curses uses, other UIs
+// translate their keys to match.
+const (
+	keyDown   = 0402
+	keyUp     = 0403
+	keyLeft   = 0404
+	keyRight  = 0405
+	keyHome   = 0406
+	keyNPage  = 0522
+	keyPPage  = 0523
+	keyA1     = 0534 // Keypad top left
+	keyA3     = 0535
+	keyB2     = 0536
+	keyC1     = 0537
+	keyC3     = 0540
+	keyEnd    = 0550
+	keyEsc    = 033
+	keyResize = 0632 // Not a key, the terminal changed size
+	keyHangup = 0633 // Not a key, the terminal has gone: quit whatever the keymap says
+)
+
+var keyNames = map[string]int{
+	"up": keyUp, "down": keyDown, "left": keyLeft, "right": keyRight,
+	"home": keyHome, "end": keyEnd, "pgup": keyPPage, "pgdn": keyNPage,
+	"kp7": keyA1, "kp9": keyA3, "kp5": keyB2, "kp1": keyC1, "kp3": keyC3,
+	"space": ' ', "esc": keyEsc,
+}
+
+// Keymap gives the command bound to each key code
+type Keymap map[int]int
+
+var keymap = DefaultKeymap()
+
+func DefaultKeymap() Keymap {
+	km := Keymap{
+		'h': moveWest, 'l': moveEast, 'j': moveSouth, 'k': moveNorth,
+		'u': moveNorthEast, 'y': moveNorthWest, 'b': moveSouthWest, 'n': moveSouthEast,
+		'.': moveHere,
+
+		keyLeft: moveWest, keyRight: moveEast, keyDown: moveSouth, keyUp: moveNorth,
+		keyA3: moveNorthEast, keyA1: moveNorthWest, keyC1: moveSouthWest, keyC3: moveSouthEast,
+		keyB2:    moveHere,
+		keyPPage: moveNorthEast, keyHome: moveNorthWest, keyEnd: moveSouthWest, keyNPage: moveSouthEast,
+
+		'm': actionMenu, 'c': createCommand, 'r': repairCommand, 's': salvageCommand,
+		'a': activateCommand, 'p': pressureCommand, 'e': energyCommand, 'H': helmetCommand,
+		';': lookCommand, 'L': logCommand, 'd': debugCommand, '?': helpCommand, 'q': quitCommand,
+	}
+	// The number pad with num lock on
+	for key, command := range map[int]int{'4': moveWest, '6': moveEast, '2': moveSouth, '8': moveNorth,
+		'9': moveNorthEast, '7': moveNorthWest, '1': moveSouthWest, '3': moveSouthEast, '5': moveHere} {
+		km[key] = command
+	}
+	return km
+}
+
+func parseKey(s string) (int, error) {
+	if code, ok := keyNames[s]; ok {
+		return code, nil
+	}
+	if strings.HasPrefix(s, "code:") {
+		return strconv.Atoi(s[len("code:"):])
+	}
+	if r := []rune(s); len(r) == 1 {
+		return int(r[0]), nil
+	}
+	return 0, fmt.Errorf("unknown key %q", s)
+}
+
+func keyName(key int) string {
+	for name, code := range keyNames {
+		if code == key {
+			return name
+		}
+	}
+	if key > ' ' && key < 0x7f {
+		return string(rune(key))
+	}
+	return fmt.Sprintf("code:%v", key)
+}
+
+// LoadKeymap reads bindings into km, replacing what was bound to those keys.
+func LoadKeymap(r io.Reader, km Keymap) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("line %v: expected \"<key> <command>\"", line)
+		}
+		key, err := parseKey(fields[0])
+		if err != nil {
+			return fmt.Errorf("line %v: %v", line, err)
+		}
+		command := -1
+		for c := range commandInfo {
+			if commandInfo[c].name == fields[1] {
+				command = c
+			}
+		}
+		if command < 0 {
+			return fmt.Errorf("line %v: unknown command %q", line, fields[1])
+		}
+		if command == noCommand {
+			delete(km, key)
+		} else {
+			km[key] = command
+		}
+	}
+	return scanner.Err()
+}
+
+// LoadKeymapFile returns the default bindings with those in the file on top,
+// a missing file just leaves the defaults.
+func LoadKeymapFile(filename string) (Keymap, error) {
+	km := DefaultKeymap()
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return km, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err = LoadKeymap(file, km); err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return km, nil
+}
+
+// Help lists every command with the keys bound to it, two to a line.
+func (km Keymap) Help() []string {
+	keys := make([][]string, maxCommand)
+	var codes []int
+	for key := range km {
+		codes = append(codes, key)
+	}
+	sort.Ints(codes)
+	for _, key := range codes {
+		keys[km[key]] = append(keys[km[key]], keyName(key))
+	}
+	var entries []string
+	for c := moveWest; c < maxCommand; c++ {
+		bound := strings.Join(keys[c], " ")
+		if bound == "" {
+			bound = "(unbound)"
+		}
+		entries = append(entries, fmt.Sprintf("%-18v %v", commandInfo[c].help, bound))
+	}
+	var lines []string
+	for i := 0; i < len(entries); i += 2 {
+		if i+1 < len(entries) {
+			lines = append(lines, fmt.Sprintf("%-38v %v", entries[i], entries[i+1]))
+		} else {
+			lines = append(lines, entries[i])
+		}
+	}
+	return lines
+}
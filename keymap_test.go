@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeymap(t *testing.T) {
+	km := DefaultKeymap()
+	err := LoadKeymap(strings.NewReader(`
+# Arrows only
+h none
+w north
+space salvage
+code:9 help
+`), km)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if !(km['w'] == moveNorth && km['k'] == moveNorth && km[' '] == salvageCommand && km[9] == helpCommand) {
+		t.Errorf("bindings not loaded")
+	}
+	_, bound := km['h']
+	if bound {
+		t.Errorf("h still bound")
+	}
+	if !(km[keyLeft] == moveWest && km['s'] == salvageCommand) {
+		t.Errorf("defaults lost")
+	}
+
+	for _, bad := range []string{"h west east", "hh west", "h fly", "code:x west"} {
+		if LoadKeymap(strings.NewReader(bad), DefaultKeymap()) == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	// Every command is in the help, with its keys
+	help := strings.Join(km.Help(), "\n")
+	for c := moveWest; c < maxCommand; c++ {
+		if !strings.Contains(help, commandInfo[c].help) {
+			t.Errorf("no help for %v", commandInfo[c].name)
+		}
+	}
+	if !strings.Contains(help, "Move north         8 k w up") {
+		t.Errorf("help gave\n%v", help)
+	}
+	if !strings.Contains(help, "Salvage            space s") {
+		t.Errorf("help gave\n%v", help)
+	}
+}
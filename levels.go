@@ -3,8 +3,9 @@ package main
 import (
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"sort"
+	"time"
 )
 
 type Room interface {
@@ -16,8 +17,6 @@ type Room interface {
 	addToLevel(*Level)
 }
 
-func GenerateLevel() {}
-
 ///////////// RECTANGLE ROOM ///////////////////
 type RectRoom struct{ x, y, w, h int }
 
@@ -43,21 +42,21 @@ func (room *RectRoom) addToLevel(level *Level) {
 		level.cells[room.x+room.w-1][j] = new(Wall)
 	}
 }
-func (room *RectRoom) subdiv() (bool, []*RectRoom) {
+func (room *RectRoom) subdiv(rng *RNG) (bool, []*RectRoom) {
 	rooms := make([]*RectRoom, 2)
-	// Choose an axis
-	if 0 == rand.Intn(2) {
-		if room.w <= 5 { // #.#.# 
+	// Choose an axis, favouring cutting across the longer side
+	if rng.Intn(room.w+room.h) < room.w {
+		if room.w <= 5 { // #.#.#
 			return false, rooms
 		}
-		neww := 3 + rand.Intn(room.w-5)
+		neww := 3 + rng.Intn(room.w-5)
 		rooms[0] = &RectRoom{room.x, room.y, neww, room.h}
 		rooms[1] = &RectRoom{room.x + neww - 1, room.y, room.w - neww + 1, room.h}
 	} else {
 		if room.h <= 5 {
 			return false, rooms
 		}
-		newh := 3 + rand.Intn(room.h-5)
+		newh := 3 + rng.Intn(room.h-5)
 		rooms[0] = &RectRoom{room.x, room.y, room.w, newh}
 		rooms[1] = &RectRoom{room.x, room.y + newh - 1, room.w, room.h - newh + 1}
 	}
@@ -125,79 +124,411 @@ func (r *CircleRoom) addToLevel(level *Level) {
 }
 
 ///////////// LEVEL GEN ///////////////////
-func min(x, y int) int {
-	if x < y {
-		return x
+const (
+	minRoomArea    = 20 // Rooms smaller than this are never split
+	maxRoomArea    = 80 // Rooms larger than this are always split
+	plantRoomSize  = 6  // Rooms need a 4x4 interior to house a plant
+	blockRoomSize  = 4  // But a 2x2 one will do if there is nothing bigger
+	roomsPerPlant  = 25 // One more air plant per this many rooms
+	wallDamageRate = 0.1
+	bulkheadRate   = 0.25 // Chance a door between rooms is an emergency bulkhead
+)
+
+// A shared wall left behind by splitting a room in two
+type split struct {
+	x, y     int
+	vertical bool
+	length   int
+}
+
+func bsp(rng *RNG, room *RectRoom, rooms []*RectRoom, splits []split) ([]*RectRoom, []split) {
+	area := room.w * room.h
+	if area < maxRoomArea && (area < minRoomArea || rng.Intn(maxRoomArea) > area) {
+		return append(rooms, room), splits
+	}
+	ok, halves := room.subdiv(rng)
+	if !ok {
+		// subdiv picks the axis at random, another go may cut the other way
+		if ok, halves = room.subdiv(rng); !ok {
+			return append(rooms, room), splits
+		}
+	}
+	if halves[0].x != halves[1].x {
+		splits = append(splits, split{halves[1].x, room.y, true, room.h})
 	} else {
-		return y
+		splits = append(splits, split{room.x, halves[1].y, false, room.w})
+	}
+	rooms, splits = bsp(rng, halves[0], rooms, splits)
+	return bsp(rng, halves[1], rooms, splits)
+}
+
+func isFloor(c Cell) bool { _, ok := c.(*Floor); return ok }
+func isWall(c Cell) bool  { _, ok := c.(*Wall); return ok }
+func isDoor(c Cell) bool {
+	switch c.(type) {
+	case *Door, *DoorConduit, *Bulkhead:
+		return true
+	}
+	return false
+}
+
+// doorway reports whether a door at x, y would join floor on either side
+func doorway(level *Level, x, y int, vertical bool) bool {
+	if !isWall(level.cells[x][y]) {
+		return false
+	}
+	if vertical {
+		return isFloor(level.cells[x-1][y]) && isFloor(level.cells[x+1][y])
+	}
+	return isFloor(level.cells[x][y-1]) && isFloor(level.cells[x][y+1])
+}
+
+func addDoor(rng *RNG, level *Level, s split) {
+	candidates := make([][2]int, 0, s.length)
+	for k := 1; k < s.length-1; k++ {
+		x, y := s.x, s.y+k
+		if !s.vertical {
+			x, y = s.x+k, s.y
+		}
+		if doorway(level, x, y, s.vertical) {
+			candidates = append(candidates, [2]int{x, y})
+		}
+	}
+	if len(candidates) > 0 {
+		c := candidates[rng.Intn(len(candidates))]
+		level.cells[c[0]][c[1]] = new(Door)
+	}
+}
+
+// reachable floods out from the exit through everything walkable or openable
+func reachable(level *Level) [][]bool {
+	reached := make([][]bool, level.x)
+	for i := range reached {
+		reached[i] = make([]bool, level.y)
+	}
+	todo := [][2]int{{level.exit_x, level.exit_y}}
+	reached[level.exit_x][level.exit_y] = true
+	for len(todo) > 0 {
+		c := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			x, y := c[0]+d[0], c[1]+d[1]
+			if x < 0 || x >= level.x || y < 0 || y >= level.y || reached[x][y] {
+				continue
+			}
+			if _, vac := level.cells[x][y].(*Vacuum); vac {
+				continue
+			}
+			if isDoor(level.cells[x][y]) || level.cells[x][y].Walkable() {
+				reached[x][y] = true
+				todo = append(todo, [2]int{x, y})
+			}
+		}
+	}
+	return reached
+}
+
+// connect adds doors until every floor cell can be reached from the exit.
+func connect(level *Level) {
+	for {
+		reached := reachable(level)
+		added := false
+		for i := 1; i < level.x-1 && !added; i++ {
+			for j := 1; j < level.y-1 && !added; j++ {
+				if !isWall(level.cells[i][j]) {
+					continue
+				}
+				for _, vertical := range []bool{true, false} {
+					a, b := [2]int{i - 1, j}, [2]int{i + 1, j}
+					if !vertical {
+						a, b = [2]int{i, j - 1}, [2]int{i, j + 1}
+					}
+					if doorway(level, i, j, vertical) && reached[a[0]][a[1]] != reached[b[0]][b[1]] {
+						Dlog.Printf("   connect: door at %v, %v\n", i, j)
+						level.cells[i][j] = new(Door)
+						added = true
+						break
+					}
+				}
+			}
+		}
+		if !added {
+			return
+		}
+	}
+}
+
+// placeBattery puts a part charged backup battery next to the block
+// somewhere it doesn't cut off any of the room.
+func placeBattery(rng *RNG, level *Level, block [][2]int) {
+	for _, b := range block {
+		for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			x, y := b[0]+d[0], b[1]+d[1]
+			if !isFloor(level.cells[x][y]) || nextToDoor(level, x, y) {
+				continue
+			}
+			level.cells[x][y] = &Battery{discharging: true, charge: rng.Float64() * batteryCapacity}
+			if allReachable(level) {
+				return
+			}
+			level.cells[x][y] = new(Floor)
+		}
+	}
+}
+
+func allReachable(level *Level) bool {
+	reached := reachable(level)
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if isFloor(level.cells[i][j]) && !reached[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func nextToDoor(level *Level, x, y int) bool {
+	for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		if isDoor(level.cells[x+d[0]][y+d[1]]) {
+			return true
+		}
 	}
-	return 0
+	return false
 }
-func generateLevel(x, y int) *Level {
+
+// placeBlock puts a 2x2 block of equipment in the room away from its doors,
+// never where it would cut off part of the level.
+func placeBlock(rng *RNG, level *Level, room *RectRoom, create func() Cell) ([][2]int, bool) {
+	for tries := 0; tries < 20; tries++ {
+		x := room.x + 1 + rng.Intn(room.w-3)
+		y := room.y + 1 + rng.Intn(room.h-3)
+		block := [][2]int{{x, y}, {x + 1, y}, {x, y + 1}, {x + 1, y + 1}}
+		ok := true
+		for _, c := range block {
+			if !isFloor(level.cells[c[0]][c[1]]) || nextToDoor(level, c[0], c[1]) {
+				ok = false
+			}
+		}
+		if !ok {
+			continue
+		}
+		for _, c := range block {
+			level.cells[c[0]][c[1]] = create()
+		}
+		if allReachable(level) {
+			return block, true
+		}
+		for _, c := range block {
+			level.cells[c[0]][c[1]] = new(Floor)
+		}
+	}
+	return nil, false
+}
+
+// layConduit runs the cheapest conduit from any cell in from to any in to,
+// preferring floors and door frames to cutting through walls and never
+// running along the hull itself.
+func layConduit(level *Level, hull *RectRoom, from, to [][2]int) {
+	const floorCost, doorCost, wallCost = 1, 2, 4
+	prev := make(map[[2]int][2]int)
+	goal := make(map[[2]int]bool)
+	for _, c := range to {
+		goal[c] = true
+	}
+	// Costs are small so a bucket per total cost makes a simple priority queue
+	buckets := [][][2]int{append([][2]int(nil), from...)}
+	for _, c := range from {
+		prev[c] = c
+	}
+	for cost := 0; cost < len(buckets); cost++ {
+		for k := 0; k < len(buckets[cost]); k++ {
+			c := buckets[cost][k]
+			for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				n := [2]int{c[0] + d[0], c[1] + d[1]}
+				if _, seen := prev[n]; seen {
+					continue
+				}
+				if goal[n] {
+					// Walk back laying conduit
+					for p := c; prev[p] != p; p = prev[p] {
+						if isWall(level.cells[p[0]][p[1]]) {
+							level.cells[p[0]][p[1]] = new(WallConduit)
+						} else if isFloor(level.cells[p[0]][p[1]]) {
+							level.cells[p[0]][p[1]] = new(Conduit)
+						} else if door, ok := level.cells[p[0]][p[1]].(*Door); ok {
+							level.cells[p[0]][p[1]] = &DoorConduit{open: door.open}
+						}
+					}
+					return
+				}
+				if n[0] <= hull.minX() || n[0] >= hull.maxX() || n[1] <= hull.minY() || n[1] >= hull.maxY() {
+					continue
+				}
+				step := 0
+				switch level.cells[n[0]][n[1]].(type) {
+				case *Conduit, *WallConduit, *DoorConduit:
+					step = 0
+				case *Floor:
+					step = floorCost
+				case *Door:
+					step = doorCost
+				case *Wall:
+					step = wallCost
+				default:
+					continue
+				}
+				prev[n] = c
+				for len(buckets) <= cost+step {
+					buckets = append(buckets, nil)
+				}
+				buckets[cost+step] = append(buckets[cost+step], n)
+			}
+		}
+	}
+	Dlog.Println("   layConduit: no route")
+}
+
+// addBulkheads makes some of the doors inside the hull emergency bulkheads,
+// left open, leaving the door to the ship and any carrying conduit alone.
+func addBulkheads(rng *RNG, level *Level, hull *RectRoom) {
+	for i := hull.minX() + 1; i < hull.maxX(); i++ {
+		for j := hull.minY() + 1; j < hull.maxY(); j++ {
+			if _, ok := level.cells[i][j].(*Door); ok && rng.Float64() < bulkheadRate {
+				level.cells[i][j] = &Bulkhead{open: true}
+			}
+		}
+	}
+}
+
+func damage(rng *RNG, level *Level, rate float64) {
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			switch c := level.cells[i][j].(type) {
+			case *Wall:
+				c.damaged = rng.Float64() < rate*wallDamageRate
+			case *Door:
+				c.damaged = rng.Float64() < rate
+			case *DoorConduit:
+				c.damaged = rng.Float64() < rate
+			case *Bulkhead:
+				c.damaged = rng.Float64() < rate
+			case *Conduit:
+				c.damaged = rng.Float64() < rate
+			case *WallConduit:
+				c.damaged = rng.Float64() < rate
+			case *PowerPlant:
+				c.damaged = rng.Float64() < rate
+			case *AirPlant:
+				c.damaged = rng.Float64() < rate
+			case *Battery:
+				c.damaged = rng.Float64() < rate
+			}
+		}
+	}
+}
+
+// GenerateLevel builds a derelict filling an x by y level. Rooms are made by
+// splitting the hull, every room is reachable from the entrance on the left
+// of the hull, and each air plant is wired to a power plant. damage is the
+// chance each piece of equipment starts out broken.
+func GenerateLevel(rng *RNG, x, y int, damageRate float64) *Level {
+	Dlog.Println("-> GenerateLevel", x, y, damageRate)
 	level := new(Level)
 	level.x, level.y = x, y
 	level.Init()
-	for i := 0; i < 50; i++ {
-		room := new(RectRoom)
-		room.x = rand.Intn(x - 5)
-		room.y = rand.Intn(y - 5)
-		room.w = 5 + rand.Intn(min(10, x-room.x-5))
-		room.h = 5 + rand.Intn(min(10, y-room.y-5))
-		room.addToLevel(level)
-	}
-	for i := 0; i < 5; i++ {
-		room := new(CircleRoom)
-		room.x = 5 + rand.Intn(x-10)
-		room.y = 5 + rand.Intn(y-10)
-		room.r = 2 + rand.Intn(5)
-		room.addToLevel(level)
+	level.rng = rng
+
+	// Leave a ring of vacuum around the hull with the entrance on the left
+	hull := &RectRoom{1, 1, x - 2, y - 2}
+	rooms, splits := bsp(rng, hull, nil, nil)
+	for _, r := range rooms {
+		r.addToLevel(level)
+	}
+	for _, s := range splits {
+		addDoor(rng, level, s)
 	}
-	return level
-}
 
-func testLevel() {
-	r := RectRoom{0, 0, 69, 23}
-	r.Print()
-	fmt.Println("---")
-	_, rooms := r.subdiv()
-	for i := 0; i < 10; i++ {
-		new_rooms := make([]*RectRoom, 0)
-		for _, r := range rooms {
-			ok, rs := r.subdiv()
-			if ok {
-				new_rooms = append(new_rooms, rs...)
-			} else {
-				new_rooms = append(new_rooms, r)
+	entrances := make([]int, 0, y)
+	for j := hull.minY() + 1; j < hull.maxY(); j++ {
+		if doorway(level, hull.minX(), j, true) {
+			entrances = append(entrances, j)
+		}
+	}
+	ey := (hull.minY() + hull.maxY()) / 2
+	if len(entrances) > 0 {
+		ey = entrances[rng.Intn(len(entrances))]
+	} else {
+		level.cells[hull.minX()+1][ey] = new(Floor)
+	}
+	level.cells[hull.minX()][ey] = new(Door)
+	level.cells[0][ey] = new(EntranceExit)
+	// Dock the ship so its air only flows in through the door
+	level.cells[0][ey-1] = new(Wall)
+	level.cells[0][ey+1] = new(Wall)
+	level.exit_x, level.exit_y = 0, ey
+
+	connect(level)
+
+	// Equipment goes in the bigger rooms, failing those the largest there are
+	var big, small []*RectRoom
+	for _, r := range rooms {
+		if r.w >= plantRoomSize && r.h >= plantRoomSize {
+			big = append(big, r)
+		} else if r.w >= blockRoomSize && r.h >= blockRoomSize {
+			small = append(small, r)
+		}
+	}
+	rng.Shuffle(len(big), func(i, j int) { big[i], big[j] = big[j], big[i] })
+	sort.SliceStable(small, func(i, j int) bool { return small[i].w*small[i].h > small[j].w*small[j].h })
+	plantRooms := append(big, small...)
+	var power [][2]int
+	placeAir := func(r *RectRoom) bool {
+		air, ok := placeBlock(rng, level, r, func() Cell { return new(AirPlant) })
+		if ok {
+			layConduit(level, hull, power, air)
+		}
+		return ok
+	}
+	airPlants := 1 + len(rooms)/roomsPerPlant
+	for _, r := range plantRooms {
+		if power == nil {
+			if power, _ = placeBlock(rng, level, r, func() Cell { return new(PowerPlant) }); power != nil {
+				placeBattery(rng, level, power)
 			}
+		} else if airPlants > 0 && placeAir(r) {
+			airPlants--
 		}
-		for _, r := range new_rooms {
-			r.Print()
+	}
+	// Too few rooms to go round, the air plant has to share one
+	if power != nil && airPlants == 1+len(rooms)/roomsPerPlant {
+		for _, r := range plantRooms {
+			if placeAir(r) {
+				break
+			}
 		}
-		fmt.Println("---")
-		rooms = new_rooms
 	}
 
+	addBulkheads(rng, level, hull)
+	damage(rng, level, damageRate)
+	Dlog.Println("<- GenerateLevel", len(rooms), "rooms")
+	return level
+}
+
+func testLevel() {
 	file, err := os.Create("level")
 	if err != nil {
 		log.Fatal(err)
 	}
 	Dlog = log.New(file, "DERELICT: ", 0)
 
-	/*
-		  level := new(Level)
-			level.x, level.y = 69, 23
-			level.Init()
-		  for _, r := range rooms { r.addToLevel(level) }
-		  cr := new(CircleRoom)
-		  cr.x, cr.y, cr.r = 20 + rand.Intn(20),10,rand.Intn(9)
-		  cr.addToLevel(level)
-	*/
-
-	level := generateLevel(69, 23)
+	level := GenerateLevel(NewRNG(time.Now().UnixNano()), 69, 23, 0.2)
+	WriteMap(os.Stdout, level)
 
 	player := new(Player)
 	player.Init()
-	ui := NewCursesUI(level, player)
+	player.x, player.y = level.exit_x, level.exit_y
+	term, _ := terminals[defaultTerminal()]()
+	ui := NewTermUI(term, level, player)
 	ui.Run()
-
 }
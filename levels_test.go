@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPlants(t *testing.T) {
+	// Even a derelict too small for any room to fit a plant comfortably gets
+	// its plants, squeezed into the largest rooms
+	for seed := int64(1); seed <= 20; seed++ {
+		level := GenerateLevel(NewRNG(seed), 14, 10, 0)
+		power, air := 0, 0
+		for i := range level.cells {
+			for _, c := range level.cells[i] {
+				switch c.(type) {
+				case *PowerPlant:
+					power++
+				case *AirPlant:
+					air++
+				}
+			}
+		}
+		if power == 0 || air == 0 {
+			t.Errorf("seed %v: %v power plant and %v air plant cells", seed, power, air)
+		}
+	}
+
+	// Wherever they go every room can still be reached
+	for _, size := range [][2]int{{69, 23}, {40, 20}, {14, 10}} {
+		for seed := int64(1); seed <= 200; seed++ {
+			if !allReachable(GenerateLevel(NewRNG(seed), size[0], size[1], 0)) {
+				t.Errorf("%vx%v seed %v: floor cut off", size[0], size[1], seed)
+			}
+		}
+	}
+}
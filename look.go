@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+)
+
+//////////////////// LOOK ////////////////////
+
+// A Reading is what the player noted about a cell when they last saw it,
+// look mode shows it in the inspect panel.
+type Reading struct {
+	known               bool // Seen at all
+	measured            bool // The air and energy were read, not e.g. after loading a game
+	description         string
+	air, energy         float64
+	damageable, damaged bool
+	salvage, repair     Cost
+	turn                int   // When it was seen
+	was                 int32 // What it looked like before, if that changed while out of view
+	noticed             int   // The turn the change was seen
+}
+
+const changedTurns = 10 // How long a change stays marked on the map
+
+// Changed reports whether the cell is to be marked as changed since it was
+// last seen.
+func (r *Reading) Changed(now int) bool { return r.was != 0 && now-r.noticed < changedTurns }
+
+// noteCell is what can be told about a cell by looking at it
+func noteCell(c Cell) Reading {
+	r := Reading{known: true, description: c.Description()}
+	if d, ok := c.(Damageable); ok {
+		r.damageable, r.damaged = true, d.Damaged()
+	}
+	if cc, ok := c.(Costed); ok {
+		r.salvage, r.repair = cc.SalvageCost(), cc.RepairCost()
+	}
+	return r
+}
+
+// readCell notes the cell at x, y with the air and energy there
+func readCell(level *Level, x, y int) Reading {
+	r := noteCell(level.cells[x][y])
+	r.measured = true
+	r.air, r.energy = level.air.air[x][y], level.energy.energy[x][y]
+	return r
+}
+
+// Inspect is the panel for a reading on turn now, visible if the cell is in
+// view and inReach if the player could work on it.
+func (r *Reading) Inspect(now int, visible, inReach bool) []string {
+	if !r.known {
+		return []string{"You haven't seen this square yet"}
+	}
+	lines := []string{r.description}
+	if r.measured && visible {
+		lines = append(lines, fmt.Sprintf("Air %.1f  Energy %.1f", r.air, r.energy))
+	} else if r.measured {
+		lines = append(lines, fmt.Sprintf("Air %.1f  Energy %.1f, %v turns ago", r.air, r.energy, now-r.turn))
+	} else {
+		lines = append(lines, "Air and energy not read")
+	}
+	if r.Changed(now) {
+		lines = append(lines, fmt.Sprintf("Changed since last seen, it was %q", r.was))
+	}
+	if r.damageable && r.damaged {
+		lines = append(lines, "Damaged")
+	} else if r.damageable {
+		lines = append(lines, "Working")
+	}
+	if r.salvage.turns > 0 {
+		lines = append(lines, "Salvage: "+r.salvage.String())
+	} else {
+		lines = append(lines, "Nothing to salvage")
+	}
+	if r.damaged && r.repair.turns > 0 {
+		lines = append(lines, "Repair: "+r.repair.String())
+	}
+	if inReach {
+		lines = append(lines, "In reach, act on it with the action keys")
+	} else if visible {
+		lines = append(lines, "Out of reach, but it can be activated from here")
+	} else {
+		lines = append(lines, "Out of reach")
+	}
+	return lines
+}
+
+// see notes the cell at x, y as in view, marking it if it has changed since
+// it was last seen.
+func (ui *TermUI) see(x, y int, wasVisible bool) {
+	now := ui.player.stats.turns
+	ch := ui.level.cells[x][y].(Drawable).Character()
+	r := readCell(ui.level, x, y)
+	r.turn = now
+	if old := &ui.readings[x][y]; old.was != 0 && old.Changed(now) {
+		r.was, r.noticed = old.was, old.noticed
+	}
+	if ui.seen[x][y] && !wasVisible && ch != ui.mapCache[x][y] {
+		r.was, r.noticed = ui.mapCache[x][y], now
+	}
+	ui.mapCache[x][y] = ch
+	ui.styles[x][y] = ui.level.StyleAt(x, y)
+	ui.seen[x][y] = true
+	ui.visible[x][y] = true
+	ui.readings[x][y] = r
+}
+
+// drawInspect shows the panel for the look cursor at the top of the map,
+// on the other side from the cursor.
+func (ui *TermUI) drawInspect() {
+	r := &ui.readings[ui.lookX][ui.lookY]
+	lines := r.Inspect(ui.player.stats.turns, ui.visible[ui.lookX][ui.lookY], ui.player.InReach(ui.lookX, ui.lookY))
+	width := 0
+	for _, line := range lines {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+	width += 2
+	x := 0
+	if ui.lookX-ui.viewX < ui.width/2 {
+		x = ui.width - 1 - width
+	}
+	if x < 0 {
+		x = 0
+	}
+	for i, line := range lines {
+		if i >= ui.viewRows() {
+			break
+		}
+		st := Style{reverse: true}
+		if i == 0 {
+			st.bold = true
+		}
+		padded := " " + line + fmt.Sprintf("%*v", width-1-len(line), "")
+		if len(padded) > ui.width-1-x {
+			padded = padded[:ui.width-1-x]
+		}
+		ui.term.Print(x, messageRows+i, padded, st)
+	}
+}
+
+// act takes an action on a cell next to the player, or on the one under
+// the look cursor in look mode. Look mode stays on if nothing was done, so
+// the player can pick another square.
+func (ui *TermUI) act(action int) int {
+	if !ui.lookMode {
+		return ui.player.Action(ui.level, ui, action)
+	}
+	turns := ui.player.ActionAt(ui.level, ui, action, ui.lookX, ui.lookY, ui.visible[ui.lookX][ui.lookY])
+	if turns > 0 || ui.player.Working() {
+		ui.lookMode = false
+	}
+	return turns
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLook(t *testing.T) {
+	if cost := (Cost{10, 0, 10}); cost.String() != "0-9 steel, 1-9 turns" {
+		t.Errorf("cost %v", cost)
+	}
+
+	// What was seen stays as it was when the cell changes
+	level, player, ui := testBench(&Door{damaged: true})
+	level.air.air[1][0] = 4
+	r := readCell(level, 1, 0)
+	level.cells[1][0] = new(Floor)
+	panel := strings.Join(r.Inspect(0, true, true), "\n")
+	for _, want := range []string{"A door", "Air 4.0", "Damaged", "Salvage: 0-9 steel, 0-9 copper, 1-14 turns",
+		"Repair: 0-4 steel, 0-4 copper, 1-9 turns", "In reach"} {
+		if !strings.Contains(panel, want) {
+			t.Errorf("no %q in\n%v", want, panel)
+		}
+	}
+	r = noteCell(new(Vacuum))
+	panel = strings.Join(r.Inspect(0, true, false), "\n")
+	if !(strings.Contains(panel, "Nothing to salvage") && strings.Contains(panel, "not read") &&
+		!strings.Contains(panel, "Repair") && strings.Contains(panel, "Out of reach")) {
+		t.Errorf("vacuum\n%v", panel)
+	}
+
+	// Acting on the look cursor
+	level, player, ui = testBench(new(Wall), DirectionAnswer(0, 0))
+	level.cells[0][0] = new(Wall)
+	level.cells[1][0] = new(Floor)
+	player.x = 1
+	player.ActionAt(level, ui, SALVAGE, 0, 0, true)
+	for player.Working() {
+		player.Work(level, ui, player.Watch(level))
+	}
+	if kind(level.cells[0][0]) != "Floor" {
+		t.Errorf("salvaged the wall into %v", kind(level.cells[0][0]))
+	}
+	if len(ui.answers) != 1 {
+		t.Errorf("asked for a direction")
+	}
+	player.x, player.y = 5, 5
+	if !(player.ActionAt(level, ui, ACTIVATE, 0, 0, false) == 0 && ui.LastMessage() == "That is out of reach") {
+		t.Errorf("acted out of reach, %q", ui.LastMessage())
+	}
+	if !(player.ActionAt(level, ui, SALVAGE, 0, 0, true) == 0 && ui.LastMessage() == "That is out of reach") {
+		t.Errorf("salvaged out of reach, %q", ui.LastMessage())
+	}
+
+	// Anything in view can be activated from afar
+	level = new(Level)
+	level.x, level.y = 6, 1
+	level.Init()
+	level.rng = NewRNG(1)
+	for i := 0; i < 5; i++ {
+		level.cells[i][0] = new(Floor)
+	}
+	door := new(Door)
+	level.cells[5][0] = door
+	player.x, player.y = 0, 0
+	look := NewTermUI(nil, level, player)
+	look.lookMode, look.lookX, look.lookY = true, 5, 0
+	look.act(SALVAGE)
+	if said := look.log.Entries(); !(look.lookMode && said[len(said)-1].text == "That is out of reach") {
+		t.Errorf("refused salvage left look mode %v, %v", look.lookMode, said)
+	}
+	look.visible[5][0] = true
+	if !(look.act(ACTIVATE) > 0 && door.open && !look.lookMode) {
+		t.Errorf("activated from afar: open %v, look mode %v", door.open, look.lookMode)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	level, player, _ := testBench(new(Door))
+	ui := NewTermUI(nil, level, player)
+	ui.see(1, 0, false)
+	if !(ui.mapCache[1][0] == '+' && ui.visible[1][0] && !ui.readings[1][0].Changed(0)) {
+		t.Errorf("first sight")
+	}
+
+	// Seen to change while in view is no surprise
+	level.cells[1][0] = &Door{open: true}
+	ui.see(1, 0, true)
+	if ui.readings[1][0].Changed(0) {
+		t.Errorf("change in view marked")
+	}
+
+	// Changed while out of view
+	level.cells[1][0] = new(Floor)
+	level.air.air[1][0] = 6
+	player.stats.turns = 20
+	ui.see(1, 0, false)
+	r := &ui.readings[1][0]
+	if !(r.Changed(20) && r.was == '/') {
+		t.Errorf("change not marked, was %q", r.was)
+	}
+	if !strings.Contains(strings.Join(r.Inspect(20, true, true), "\n"), "it was '/'") {
+		t.Errorf("panel has no change")
+	}
+	if r.Changed(20 + changedTurns) {
+		t.Errorf("change marked for ever")
+	}
+
+	// Readings remembered with their age
+	panel := strings.Join(r.Inspect(27, false, true), "\n")
+	if !strings.Contains(panel, "Air 6.0  Energy 0.0, 7 turns ago") {
+		t.Errorf("panel\n%v", panel)
+	}
+	var buf bytes.Buffer
+	if err := SaveGame(&buf, level, player, ui.memory()); err != nil {
+		t.Fatal(err)
+	}
+	loadedLevel, loadedPlayer, memory, err := LoadGame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ui = NewTermUI(nil, loadedLevel, loadedPlayer)
+	ui.restoreMemory(memory)
+	r = &ui.readings[1][0]
+	if !(r.known && r.measured && r.air == 6 && r.turn == 20 && r.description == "The floor") {
+		t.Errorf("loaded %+v", *r)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+////////////////////// MAP FILES /////////////////////////
+
+// A map file draws the ship using the same characters the cells display,
+// one line per row. Anything the characters cannot show goes in a legend
+// after a line starting with "==", one entry per line:
+//
+//	exit x y     - the entrance/exit (and where the player starts)
+//	damaged x y  - the cell at x, y is damaged
+//	open x y     - the door or bulkhead at x, y is open
+//	discharging x y - the battery at x, y is set to discharge
+//
+// Blank lines and lines starting with ';' in the legend are ignored. Rows
+// shorter than the longest row are padded with vacuum.
+const mapLegendSeparator = "=="
+
+func cellFromGlyph(ch rune) (Cell, bool) {
+	switch ch {
+	case ' ':
+		return new(Vacuum), true
+	case '.':
+		return new(Floor), true
+	case '#':
+		return new(Wall), true
+	case '+':
+		return new(Door), true
+	case '/':
+		return &Door{open: true}, true
+	case '&':
+		return new(DoorConduit), true
+	case '\'':
+		return &DoorConduit{open: true}, true
+	case 'H':
+		return new(Bulkhead), true
+	case ':':
+		return &Bulkhead{open: true}, true
+	case '-':
+		return new(Conduit), true
+	case '~':
+		return &Conduit{damaged: true}, true
+	case '*':
+		return new(WallConduit), true
+	case '%':
+		return &WallConduit{damaged: true}, true
+	case 'P':
+		return new(PowerPlant), true
+	case 'p':
+		return &PowerPlant{damaged: true}, true
+	case 'A':
+		return new(AirPlant), true
+	case 'a':
+		return &AirPlant{damaged: true}, true
+	case 'B':
+		return new(Battery), true
+	case 'b':
+		return &Battery{damaged: true}, true
+	}
+	return nil, false
+}
+
+func LoadMap(r io.Reader) (*Level, error) {
+	Dlog.Println("-> LoadMap")
+	scanner := bufio.NewScanner(r)
+	var rows [][]rune
+	width := 0
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.HasPrefix(scanner.Text(), mapLegendSeparator) {
+			break
+		}
+		row := []rune(strings.TrimRight(scanner.Text(), "\r"))
+		if len(row) > width {
+			width = len(row)
+		}
+		rows = append(rows, row)
+	}
+	if width == 0 || len(rows) == 0 {
+		return nil, fmt.Errorf("map is empty")
+	}
+
+	level := new(Level)
+	level.x, level.y = width, len(rows)
+	level.Init()
+	for j, row := range rows {
+		for i, ch := range row {
+			cell, ok := cellFromGlyph(ch)
+			if !ok {
+				return nil, fmt.Errorf("line %v: unknown map character %q", j+1, ch)
+			}
+			level.cells[i][j] = cell
+		}
+	}
+
+	haveExit := false
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		var x, y int
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %v: expected \"<entry> x y\"", line)
+		}
+		if _, err := fmt.Sscan(fields[1], &x); err != nil {
+			return nil, fmt.Errorf("line %v: bad x: %v", line, err)
+		}
+		if _, err := fmt.Sscan(fields[2], &y); err != nil {
+			return nil, fmt.Errorf("line %v: bad y: %v", line, err)
+		}
+		if x < 0 || x >= level.x || y < 0 || y >= level.y {
+			return nil, fmt.Errorf("line %v: %v, %v is off the map", line, x, y)
+		}
+		switch fields[0] {
+		case "exit":
+			level.cells[x][y] = new(EntranceExit)
+			level.exit_x, level.exit_y = x, y
+			haveExit = true
+		case "damaged":
+			if !setDamage(level.cells[x][y], true) {
+				return nil, fmt.Errorf("line %v: %v cannot be damaged", line, level.cells[x][y].Description())
+			}
+		case "open":
+			switch door := level.cells[x][y].(type) {
+			case *Door:
+				door.open = true
+			case *DoorConduit:
+				door.open = true
+			case *Bulkhead:
+				door.open = true
+			default:
+				return nil, fmt.Errorf("line %v: only doors and bulkheads can be open", line)
+			}
+		case "discharging":
+			battery, ok := level.cells[x][y].(*Battery)
+			if !ok {
+				return nil, fmt.Errorf("line %v: only batteries can discharge", line)
+			}
+			battery.discharging = true
+		default:
+			return nil, fmt.Errorf("line %v: unknown legend entry %q", line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !haveExit {
+		return nil, fmt.Errorf("map has no exit")
+	}
+	Dlog.Println("<- LoadMap", level.x, level.y)
+	return level, nil
+}
+
+// setDamage marks a cell as damaged or not, returning false if it cannot be.
+func setDamage(c Cell, damaged bool) bool {
+	switch c := c.(type) {
+	case *Wall:
+		c.damaged = damaged
+	case *Door:
+		c.damaged = damaged
+	case *DoorConduit:
+		c.damaged = damaged
+	case *Bulkhead:
+		c.damaged = damaged
+	case *Conduit:
+		c.damaged = damaged
+	case *WallConduit:
+		c.damaged = damaged
+	case *PowerPlant:
+		c.damaged = damaged
+	case *AirPlant:
+		c.damaged = damaged
+	case *Battery:
+		c.damaged = damaged
+	default:
+		return false
+	}
+	return true
+}
+
+// WriteMap writes a level in the format read by LoadMap.
+func WriteMap(w io.Writer, level *Level) error {
+	bw := bufio.NewWriter(w)
+	var legend []string
+	for j := 0; j < level.y; j++ {
+		row := make([]rune, level.x)
+		for i := 0; i < level.x; i++ {
+			switch c := level.cells[i][j].(type) {
+			case *EntranceExit:
+				legend = append(legend, fmt.Sprintf("exit %v %v", i, j))
+			case *Wall:
+				if c.damaged {
+					legend = append(legend, fmt.Sprintf("damaged %v %v", i, j))
+				}
+			case *Door:
+				if c.damaged {
+					legend = append(legend, fmt.Sprintf("damaged %v %v", i, j))
+				}
+			case *DoorConduit:
+				if c.damaged {
+					legend = append(legend, fmt.Sprintf("damaged %v %v", i, j))
+				}
+			case *Bulkhead:
+				if c.damaged {
+					legend = append(legend, fmt.Sprintf("damaged %v %v", i, j))
+				}
+			case *Battery:
+				if c.discharging {
+					legend = append(legend, fmt.Sprintf("discharging %v %v", i, j))
+				}
+			}
+			row[i] = level.cells[i][j].(Drawable).Character()
+		}
+		fmt.Fprintln(bw, strings.TrimRight(string(row), " "))
+	}
+	fmt.Fprintln(bw, mapLegendSeparator)
+	for _, l := range legend {
+		fmt.Fprintln(bw, l)
+	}
+	return bw.Flush()
+}
+
+func LoadMapFile(filename string) (*Level, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	level, err := LoadMap(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return level, nil
+}
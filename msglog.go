@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+)
+
+////////////////////// MESSAGE LOG /////////////////////////
+
+// Message categories, the UI shows each in its own colour
+const (
+	infoMessage = iota
+	dangerMessage
+	successMessage
+)
+
+const maxLogEntries = 500
+
+type LogEntry struct {
+	turn  int // When it was last said
+	text  string
+	kind  int
+	count int // Times said in a row
+}
+
+func (e *LogEntry) String() string {
+	if e.count > 1 {
+		return fmt.Sprintf("%v x%v", e.text, e.count)
+	}
+	return e.text
+}
+
+// MessageLog keeps everything the player has been told, saying the same
+// thing again just counts it. It remembers which entries are new since the
+// UI last showed them.
+type MessageLog struct {
+	entries []LogEntry
+	unread  int // Index of the oldest entry added or repeated since MarkRead
+}
+
+func (l *MessageLog) Add(turn int, kind int, text string) {
+	if n := len(l.entries); n > 0 && l.entries[n-1].text == text && l.entries[n-1].kind == kind {
+		l.entries[n-1].count++
+		l.entries[n-1].turn = turn
+		if l.unread > n-1 {
+			l.unread = n - 1
+		}
+		return
+	}
+	l.entries = append(l.entries, LogEntry{turn, text, kind, 1})
+	if drop := len(l.entries) - maxLogEntries; drop > 0 {
+		l.entries = append(l.entries[:0], l.entries[drop:]...)
+		l.unread -= drop
+		if l.unread < 0 {
+			l.unread = 0
+		}
+	}
+}
+
+// Unread returns the entries added or repeated since MarkRead, oldest first.
+func (l *MessageLog) Unread() []LogEntry  { return l.entries[l.unread:] }
+func (l *MessageLog) MarkRead()           { l.unread = len(l.entries) }
+func (l *MessageLog) Entries() []LogEntry { return l.entries }
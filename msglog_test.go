@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMessageLog(t *testing.T) {
+	var l MessageLog
+	l.Add(1, infoMessage, "You fail to salvage")
+	l.Add(2, infoMessage, "You fail to salvage")
+	l.Add(3, infoMessage, "You fail to salvage")
+	if !(len(l.Entries()) == 1 && l.Entries()[0].String() == "You fail to salvage x3" && l.Entries()[0].turn == 3) {
+		t.Errorf("repeats gave %v", l.Entries())
+	}
+	l.Add(3, dangerMessage, "You fail to salvage")
+	if len(l.Entries()) != 2 {
+		t.Errorf("a repeat in another category collapsed")
+	}
+
+	// Repeating something already read makes it unread again
+	l.MarkRead()
+	if len(l.Unread()) != 0 {
+		t.Errorf("%v unread after reading", len(l.Unread()))
+	}
+	l.Add(4, dangerMessage, "You fail to salvage")
+	if !(len(l.Unread()) == 1 && l.Unread()[0].count == 2) {
+		t.Errorf("repeat unread %v", l.Unread())
+	}
+
+	// Old entries go once it is full
+	for i := 0; i < maxLogEntries+10; i++ {
+		l.Add(i, infoMessage, fmt.Sprint(i))
+	}
+	if !(len(l.Entries()) == maxLogEntries && l.Entries()[0].text == "10") {
+		t.Errorf("kept %v entries from %v", len(l.Entries()), l.Entries()[0].text)
+	}
+	if len(l.Unread()) != maxLogEntries {
+		t.Errorf("%v unread", len(l.Unread()))
+	}
+
+	// Finished work is a success
+	level, player, ui := testBench(new(Wall), DirectionAnswer(1, 0))
+	act(level, player, ui, SALVAGE)
+	if !(len(ui.kinds) > 0 && ui.kinds[len(ui.kinds)-1] == successMessage &&
+		strings.HasPrefix(ui.LastMessage(), "You salvage")) {
+		t.Errorf("salvage said %q", ui.LastMessage())
+	}
+}
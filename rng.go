@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math/rand"
+)
+
+////////////////////// RANDOM NUMBERS /////////////////////////
+
+// Counts how many numbers have been drawn so that a saved game can put its
+// generator back exactly where it was.
+type countingSource struct {
+	src   rand.Source
+	draws uint64
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+func (s *countingSource) Seed(seed int64) {
+	s.draws = 0
+	s.src.Seed(seed)
+}
+
+// RNG is the single source of randomness for a game. Everything random -
+// level generation, salvage, repairs - must draw from it so that a run can be
+// replayed from its seed.
+type RNG struct {
+	*rand.Rand
+	seed int64
+	src  *countingSource
+}
+
+func NewRNG(seed int64) *RNG {
+	src := &countingSource{src: rand.NewSource(seed)}
+	return &RNG{rand.New(src), seed, src}
+}
+
+// restoreRNG recreates a generator that has already made draws draws.
+func restoreRNG(seed int64, draws uint64) *RNG {
+	rng := NewRNG(seed)
+	for rng.src.draws < draws {
+		rng.src.Int63()
+	}
+	return rng
+}
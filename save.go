@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+////////////////////// SAVE / LOAD /////////////////////////
+
+// Save files start with a magic line and a format version followed by a gob
+// encoded saveGame. Cells are stored by name so that adding new cell types
+// never changes the meaning of an existing save. Bump saveVersion whenever a
+// change cannot be handled by gob's missing/extra field tolerance and add a
+// case to LoadGame to upgrade the older format.
+const (
+	saveMagic   = "deReLict save\n"
+	saveVersion = 1
+)
+
+type savedCell struct {
+	Kind        string
+	Damaged     bool
+	Open        bool
+	Energy      float64
+	Discharging bool
+	Charge      float64
+	Held        bool
+}
+
+type savedLevel struct {
+	X, Y         int
+	ExitX, ExitY int
+	Cells        [][]savedCell
+	Air          [][]float64
+	Energy       [][]float64
+}
+
+type savedPlayer struct {
+	X, Y   int
+	Vision int
+
+	EnergyLeft, EnergyCapacity float64
+
+	Sensor              int
+	EnergySensorRange   int
+	PressureSensorRange int
+
+	AirLeft, AirCapacity float64
+	Dead                 bool
+	LeftShip             bool
+	HelmetOn             bool
+
+	Copper, Steel int
+
+	Stats    savedStats
+	Upgrades map[string]int // By Upgrade id
+	Career   []savedRun
+	Job      *savedJob
+}
+
+type savedStats struct {
+	Steel, Copper            int
+	Repaired, Created        int
+	Turns                    int
+	AirUsed                  float64
+	StartWorking, StartTotal int
+}
+
+// The cell a job works on is the one at X, Y when the game is loaded
+type savedJob struct {
+	Action        int
+	Steel, Copper int
+	Name          string
+	X, Y          int
+	Result        *savedCell
+	Turns, Done   int
+	Active        bool
+}
+
+type savedRun struct {
+	Score             int
+	Steel, Copper     int
+	Repaired, Created int
+	Turns             int
+}
+
+type saveGame struct {
+	Level  savedLevel
+	Player savedPlayer
+
+	// Where the game's random numbers had got to
+	Seed  int64
+	Draws uint64
+
+	// What the player remembers of the level
+	MapCache [][]int32
+	Seen     [][]bool
+	Readings [][]savedReading // Missing from older saves
+}
+
+type savedReading struct {
+	Measured    bool
+	Air, Energy float64
+	Turn        int
+	Damaged     bool
+}
+
+func saveReadings(readings [][]Reading) [][]savedReading {
+	if readings == nil {
+		return nil
+	}
+	s := make([][]savedReading, len(readings))
+	for x := range readings {
+		s[x] = make([]savedReading, len(readings[x]))
+		for y, r := range readings[x] {
+			s[x][y] = savedReading{r.measured, r.air, r.energy, r.turn, r.damaged}
+		}
+	}
+	return s
+}
+
+// loadReadings gives back the readings, only what was measured: the rest is
+// told by looking at the remembered map, see restoreMemory.
+func loadReadings(s [][]savedReading) [][]Reading {
+	if s == nil {
+		return nil
+	}
+	readings := make([][]Reading, len(s))
+	for x := range s {
+		readings[x] = make([]Reading, len(s[x]))
+		for y, r := range s[x] {
+			readings[x][y] = Reading{measured: r.Measured, air: r.Air, energy: r.Energy, turn: r.Turn, damaged: r.Damaged}
+		}
+	}
+	return readings
+}
+
+func saveCell(c Cell) (s savedCell) {
+	switch c := c.(type) {
+	case *Vacuum:
+		s.Kind = "Vacuum"
+	case *Floor:
+		s.Kind = "Floor"
+	case *Wall:
+		s.Kind, s.Damaged = "Wall", c.damaged
+	case *Door:
+		s.Kind, s.Damaged, s.Open = "Door", c.damaged, c.open
+	case *DoorConduit:
+		s.Kind, s.Damaged, s.Open = "DoorConduit", c.damaged, c.open
+	case *Bulkhead:
+		s.Kind, s.Damaged, s.Open, s.Held = "Bulkhead", c.damaged, c.open, c.held
+	case *Conduit:
+		s.Kind, s.Damaged = "Conduit", c.damaged
+	case *WallConduit:
+		s.Kind, s.Damaged = "WallConduit", c.damaged
+	case *PowerPlant:
+		s.Kind, s.Damaged = "PowerPlant", c.damaged
+	case *AirPlant:
+		s.Kind, s.Damaged, s.Energy = "AirPlant", c.damaged, c.energy
+	case *EntranceExit:
+		s.Kind = "EntranceExit"
+	case *Battery:
+		s.Kind, s.Damaged = "Battery", c.damaged
+		s.Discharging, s.Charge = c.discharging, c.charge
+	default:
+		panic(fmt.Sprintf("saveCell: unknown cell type %T", c))
+	}
+	return
+}
+func loadCell(s savedCell) (Cell, error) {
+	switch s.Kind {
+	case "Vacuum":
+		return new(Vacuum), nil
+	case "Floor":
+		return new(Floor), nil
+	case "Wall":
+		return &Wall{damaged: s.Damaged}, nil
+	case "Door":
+		return &Door{open: s.Open, damaged: s.Damaged}, nil
+	case "DoorConduit":
+		return &DoorConduit{open: s.Open, damaged: s.Damaged}, nil
+	case "Bulkhead":
+		return &Bulkhead{open: s.Open, damaged: s.Damaged, held: s.Held}, nil
+	case "Conduit":
+		return &Conduit{damaged: s.Damaged}, nil
+	case "WallConduit":
+		return &WallConduit{damaged: s.Damaged}, nil
+	case "PowerPlant":
+		return &PowerPlant{damaged: s.Damaged}, nil
+	case "AirPlant":
+		return &AirPlant{damaged: s.Damaged, energy: s.Energy}, nil
+	case "EntranceExit":
+		return new(EntranceExit), nil
+	case "Battery":
+		return &Battery{damaged: s.Damaged, discharging: s.Discharging, charge: s.Charge}, nil
+	}
+	return nil, fmt.Errorf("unknown cell type %q", s.Kind)
+}
+
+func copyGrid(src [][]float64) [][]float64 {
+	dst := make([][]float64, len(src))
+	for i := range src {
+		dst[i] = append([]float64(nil), src[i]...)
+	}
+	return dst
+}
+
+func saveLevel(level *Level) (s savedLevel) {
+	s.X, s.Y = level.x, level.y
+	s.ExitX, s.ExitY = level.exit_x, level.exit_y
+	s.Cells = make([][]savedCell, level.x)
+	for i := 0; i < level.x; i++ {
+		s.Cells[i] = make([]savedCell, level.y)
+		for j := 0; j < level.y; j++ {
+			s.Cells[i][j] = saveCell(level.cells[i][j])
+		}
+	}
+	s.Air = copyGrid(level.air.air)
+	s.Energy = copyGrid(level.energy.energy)
+	return
+}
+func loadLevel(s savedLevel) (*Level, error) {
+	if s.X <= 0 || s.Y <= 0 || len(s.Cells) != s.X ||
+		len(s.Air) != s.X || len(s.Energy) != s.X {
+		return nil, errors.New("level dimensions do not match")
+	}
+	if s.ExitX < 0 || s.ExitX >= s.X || s.ExitY < 0 || s.ExitY >= s.Y {
+		return nil, errors.New("exit is off the level")
+	}
+	level := new(Level)
+	level.x, level.y = s.X, s.Y
+	level.exit_x, level.exit_y = s.ExitX, s.ExitY
+	level.Init()
+	var err error
+	for i := 0; i < level.x; i++ {
+		if len(s.Cells[i]) != s.Y || len(s.Air[i]) != s.Y || len(s.Energy[i]) != s.Y {
+			return nil, errors.New("level dimensions do not match")
+		}
+		for j := 0; j < level.y; j++ {
+			if level.cells[i][j], err = loadCell(s.Cells[i][j]); err != nil {
+				return nil, err
+			}
+		}
+		copy(level.air.air[i], s.Air[i])
+		copy(level.energy.energy[i], s.Energy[i])
+	}
+	return level, nil
+}
+
+func savePlayer(p *Player) savedPlayer {
+	return savedPlayer{
+		X: p.x, Y: p.y, Vision: p.vision,
+		EnergyLeft: p.energy_left, EnergyCapacity: p.energy_capcacity,
+		Sensor: p.sensor, EnergySensorRange: p.energy_sensor_range,
+		PressureSensorRange: p.pressure_sensor_range,
+		AirLeft:             p.air_left, AirCapacity: p.air_capacity,
+		Dead: p.dead, LeftShip: p.left_ship, HelmetOn: p.helmet_on,
+		Copper: p.copper, Steel: p.steel,
+		Upgrades: p.upgrades,
+		Career:   saveCareer(p.career),
+		Job:      saveJob(p.job),
+		Stats: savedStats{
+			Steel: p.stats.steel, Copper: p.stats.copper,
+			Repaired: p.stats.repaired, Created: p.stats.created,
+			Turns: p.stats.turns, AirUsed: p.stats.airUsed,
+			StartWorking: p.stats.startWorking, StartTotal: p.stats.startTotal,
+		},
+	}
+}
+func saveCareer(career []RunRecord) []savedRun {
+	var s []savedRun
+	for _, r := range career {
+		s = append(s, savedRun{r.score, r.steel, r.copper, r.repaired, r.created, r.turns})
+	}
+	return s
+}
+func saveJob(j *Job) *savedJob {
+	if j == nil {
+		return nil
+	}
+	s := &savedJob{Action: j.work.action, Steel: j.work.steel, Copper: j.work.copper,
+		Name: j.work.name, X: j.x, Y: j.y, Turns: j.turns, Done: j.done, Active: j.active}
+	if j.result != nil {
+		r := saveCell(j.result)
+		s.Result = &r
+	}
+	return s
+}
+func loadJob(s *savedJob, level *Level) (*Job, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if s.X < 0 || s.X >= level.x || s.Y < 0 || s.Y >= level.y {
+		return nil, errors.New("job is off the level")
+	}
+	j := &Job{work: Work{s.Action, s.Steel, s.Copper, s.Name}, x: s.X, y: s.Y,
+		cell: level.cells[s.X][s.Y], generation: level.generation, turns: s.Turns, done: s.Done, active: s.Active}
+	if s.Result != nil {
+		var err error
+		if j.result, err = loadCell(*s.Result); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+func loadPlayer(s savedPlayer) *Player {
+	p := new(Player)
+	p.x, p.y, p.vision = s.X, s.Y, s.Vision
+	p.energy_left, p.energy_capcacity = s.EnergyLeft, s.EnergyCapacity
+	p.sensor = s.Sensor
+	p.energy_sensor_range = s.EnergySensorRange
+	p.pressure_sensor_range = s.PressureSensorRange
+	p.air_left, p.air_capacity = s.AirLeft, s.AirCapacity
+	p.dead, p.left_ship, p.helmet_on = s.Dead, s.LeftShip, s.HelmetOn
+	p.copper, p.steel = s.Copper, s.Steel
+	p.upgrades = s.Upgrades
+	if p.upgrades == nil {
+		p.upgrades = make(map[string]int)
+	}
+	for _, r := range s.Career {
+		p.career = append(p.career, RunRecord{r.Score,
+			r.Steel, r.Copper, r.Repaired, r.Created, r.Turns})
+	}
+	p.stats = RunStats{
+		steel: s.Stats.Steel, copper: s.Stats.Copper,
+		repaired: s.Stats.Repaired, created: s.Stats.Created,
+		turns: s.Stats.Turns, airUsed: s.Stats.AirUsed,
+		startWorking: s.Stats.StartWorking, startTotal: s.Stats.StartTotal,
+	}
+	return p
+}
+
+// SaveGame writes the level, player and the player's memory of the level.
+func SaveGame(w io.Writer, level *Level, player *Player, memory Memory) error {
+	Dlog.Println("-> SaveGame")
+	if _, err := io.WriteString(w, saveMagic); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(saveVersion); err != nil {
+		return err
+	}
+	err := enc.Encode(saveGame{
+		Level:    saveLevel(level),
+		Player:   savePlayer(player),
+		Seed:     level.rng.seed,
+		Draws:    level.rng.src.draws,
+		MapCache: memory.mapCache,
+		Seen:     memory.seen,
+		Readings: saveReadings(memory.readings),
+	})
+	Dlog.Println("<- SaveGame", err)
+	return err
+}
+
+// LoadGame reads a game written by SaveGame, of this or any earlier version.
+func LoadGame(r io.Reader) (level *Level, player *Player, memory Memory, err error) {
+	Dlog.Println("-> LoadGame")
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(saveMagic))
+	if _, err = io.ReadFull(br, magic); err != nil || string(magic) != saveMagic {
+		return nil, nil, Memory{}, errors.New("not a derelict save file")
+	}
+	dec := gob.NewDecoder(br)
+	var version int
+	if err = dec.Decode(&version); err != nil {
+		return
+	}
+	var sg saveGame
+	switch version {
+	case 1:
+		err = dec.Decode(&sg)
+	default:
+		err = fmt.Errorf("unsupported save version %v", version)
+	}
+	if err != nil {
+		return
+	}
+
+	if level, err = loadLevel(sg.Level); err != nil {
+		return
+	}
+	level.rng = restoreRNG(sg.Seed, sg.Draws)
+	player = loadPlayer(sg.Player)
+	if player.x < 0 || player.x >= level.x || player.y < 0 || player.y >= level.y {
+		return nil, nil, Memory{}, errors.New("player is off the level")
+	}
+	if player.job, err = loadJob(sg.Player.Job, level); err != nil {
+		return nil, nil, Memory{}, err
+	}
+	memory = Memory{sg.MapCache, sg.Seen, loadReadings(sg.Readings)}
+	if !memoryFits(memory, level) {
+		return nil, nil, Memory{}, errors.New("map memory does not match level")
+	}
+	Dlog.Println("<- LoadGame")
+	return
+}
+
+// memoryFits tells whether the memory covers every square of the level.
+func memoryFits(m Memory, level *Level) bool {
+	if len(m.mapCache) != level.x || len(m.seen) != level.x ||
+		(m.readings != nil && len(m.readings) != level.x) {
+		return false
+	}
+	for i := 0; i < level.x; i++ {
+		if len(m.mapCache[i]) != level.y || len(m.seen[i]) != level.y ||
+			(m.readings != nil && len(m.readings[i]) != level.y) {
+			return false
+		}
+	}
+	return true
+}
+
+func SaveGameFile(filename string, level *Level, player *Player, memory Memory) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = SaveGame(file, level, player, memory); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+func LoadGameFile(filename string) (*Level, *Player, Memory, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, Memory{}, err
+	}
+	defer file.Close()
+	return LoadGame(file)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"testing"
+)
+
+// savedGame saves the test bench and gives back what was written.
+func savedGame(t *testing.T) saveGame {
+	level, player, _ := testBench(new(Wall))
+	var buf bytes.Buffer
+	if err := SaveGame(&buf, level, player, NewTermUI(nil, level, player).memory()); err != nil {
+		t.Fatal(err)
+	}
+	buf.Next(len(saveMagic))
+	dec := gob.NewDecoder(&buf)
+	var version int
+	var sg saveGame
+	if err := dec.Decode(&version); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&sg); err != nil {
+		t.Fatal(err)
+	}
+	return sg
+}
+
+// writeSave writes sg as SaveGame would.
+func writeSave(t *testing.T, sg saveGame) io.Reader {
+	var buf bytes.Buffer
+	buf.WriteString(saveMagic)
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(saveVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(sg); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestCorruptSave(t *testing.T) {
+	if _, _, _, err := LoadGame(writeSave(t, savedGame(t))); err != nil {
+		t.Fatalf("sound save: %v", err)
+	}
+	corrupt := []struct {
+		name  string
+		spoil func(sg *saveGame)
+	}{
+		{"short map column", func(sg *saveGame) { sg.MapCache[1] = nil }},
+		{"long map column", func(sg *saveGame) { sg.MapCache[0] = append(sg.MapCache[0], ' ') }},
+		{"short seen column", func(sg *saveGame) { sg.Seen[1] = nil }},
+		{"short readings column", func(sg *saveGame) { sg.Readings[1] = nil }},
+		{"missing readings", func(sg *saveGame) { sg.Readings = sg.Readings[:1] }},
+		{"missing map", func(sg *saveGame) { sg.MapCache = sg.MapCache[:1] }},
+		{"player east of the level", func(sg *saveGame) { sg.Player.X = 2 }},
+		{"player north of the level", func(sg *saveGame) { sg.Player.Y = -1 }},
+		{"exit south of the level", func(sg *saveGame) { sg.Level.ExitY = 1 }},
+		{"exit west of the level", func(sg *saveGame) { sg.Level.ExitX = -1 }},
+	}
+	for _, c := range corrupt {
+		sg := savedGame(t)
+		c.spoil(&sg)
+		if _, _, _, err := LoadGame(writeSave(t, sg)); err == nil {
+			t.Errorf("%v: loaded", c.name)
+		}
+	}
+}
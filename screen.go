@@ -0,0 +1,78 @@
+package main
+
+//////////////////// SCREEN BUFFER ////////////////////
+
+// screenBuffer is the screen for the Terminals that are not curses. It keeps
+// what has been drawn and what the other end is showing, so only the cells
+// that changed need sending.
+
+type screenCell struct {
+	ch int32
+	st Style
+}
+
+var blankCell = screenCell{' ', Style{}}
+
+type screenBuffer struct {
+	width, height int
+	screen        [][]screenCell // [y][x], as drawn
+	shown         [][]screenCell // As the other end has it
+}
+
+// resize blanks the screen at the new size, all of it is sent again.
+func (b *screenBuffer) resize(width, height int) {
+	b.width, b.height = width, height
+	b.screen = make([][]screenCell, height)
+	b.shown = make([][]screenCell, height)
+	for y := range b.screen {
+		b.screen[y] = make([]screenCell, width)
+		b.shown[y] = make([]screenCell, width)
+	}
+	b.Clear()
+	b.invalidate()
+}
+
+// invalidate forgets what the other end is showing, e.g. it was cleared.
+func (b *screenBuffer) invalidate() {
+	for y := range b.shown {
+		for x := range b.shown[y] {
+			b.shown[y][x] = screenCell{-1, Style{}}
+		}
+	}
+}
+
+func (b *screenBuffer) Size() (int, int) { return b.width, b.height }
+
+func (b *screenBuffer) Put(x, y int, ch int32, st Style) {
+	if x >= 0 && x < b.width && y >= 0 && y < b.height {
+		b.screen[y][x] = screenCell{ch, st}
+	}
+}
+
+func (b *screenBuffer) Print(x, y int, s string, st Style) {
+	for _, r := range s {
+		b.Put(x, y, r, st)
+		x++
+	}
+}
+
+func (b *screenBuffer) Clear() {
+	for y := range b.screen {
+		for x := range b.screen[y] {
+			b.screen[y][x] = blankCell
+		}
+	}
+}
+
+// changes calls send for each cell that differs from what is shown, row by
+// row, and takes it as shown.
+func (b *screenBuffer) changes(send func(x, y int, c screenCell)) {
+	for y := range b.screen {
+		for x, c := range b.screen[y] {
+			if c != b.shown[y][x] {
+				send(x, y, c)
+				b.shown[y][x] = c
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+)
+
+////////////////////// SHIPYARD /////////////////////////
+
+// An Upgrade is something the shipyard sells. Each time one is bought the
+// next costs the base price again on top, so the second costs twice as much
+// and the third three times.
+type Upgrade struct {
+	id            string // Never changes, counts bought in Player.upgrades and saves
+	name          string
+	steel, copper int // Base price
+	apply         func(*Player)
+}
+
+var shipyardStock = []Upgrade{
+	{"visor", "Visor: see 1 further", 20, 10, func(p *Player) { p.vision++ }},
+	{"tank", "Air tank: hold 2 more", 30, 10, func(p *Player) { p.air_capacity += 2 }},
+	{"pressure", "Pressure sensor: 1 more range", 10, 20, func(p *Player) { p.pressure_sensor_range++ }},
+	{"energy", "Energy sensor: 1 more range", 10, 25, func(p *Player) { p.energy_sensor_range++ }},
+	{"battery", "Suit battery: hold 0.5 more", 10, 30, func(p *Player) { p.energy_capcacity += 0.5 }},
+}
+
+// Refilling the tank isn't an upgrade so its price never goes up
+const refillCopper = 5
+
+func (u *Upgrade) price(p *Player) (steel, copper int) {
+	n := 1 + p.upgrades[u.id]
+	return n * u.steel, n * u.copper
+}
+
+// Shipyard lets the player spend their salvage between derelicts. It returns
+// whether they set out for another derelict.
+func Shipyard(ui UI, p *Player) bool {
+	Dlog.Println("-> Shipyard")
+	status := "Welcome to the shipyard"
+	for {
+		options := make([]string, 0, len(shipyardStock)+3)
+		for i := range shipyardStock {
+			st, cu := shipyardStock[i].price(p)
+			options = append(options, fmt.Sprintf("%v (%v steel, %v copper)", shipyardStock[i].name, st, cu))
+		}
+		options = append(options,
+			fmt.Sprintf("Refill air tank (%v copper)", refillCopper),
+			"Set out for another derelict",
+			"Head home")
+		choice, aborted := ui.Menu(fmt.Sprintf("%v - St:%v Cu:%v Air:%4.2f/%4.2f",
+			status, p.steel, p.copper, p.air_left, p.air_capacity), options)
+		switch {
+		case aborted:
+			status = "Choose what to buy, or leave"
+		case choice < len(shipyardStock):
+			u := &shipyardStock[choice]
+			st, cu := u.price(p)
+			if p.steel < st || p.copper < cu {
+				status = fmt.Sprintf("You can't afford the %v", u.name)
+			} else {
+				p.steel -= st
+				p.copper -= cu
+				p.upgrades[u.id]++
+				u.apply(p)
+				status = fmt.Sprintf("Fitted the %v", u.name)
+			}
+		case choice == len(shipyardStock):
+			if p.copper < refillCopper {
+				status = "You can't afford to refill your tank"
+			} else {
+				p.copper -= refillCopper
+				p.air_left = p.air_capacity
+				status = "Your air tank is full"
+			}
+		case choice == len(shipyardStock)+1:
+			Dlog.Println("<- Shipyard: onwards")
+			return true
+		default:
+			Dlog.Println("<- Shipyard: home")
+			return false
+		}
+	}
+}
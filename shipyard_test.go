@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShipyard(t *testing.T) {
+	_, player, ui := testBench(new(Floor))
+	player.steel, player.copper = 50, 40
+	player.air_left = 1
+	visor := shipyardStock[0]
+	vision := player.vision
+	last := len(shipyardStock) + 2
+
+	// Buy the visor twice, the second costs double and can't be afforded
+	ui.Script(MenuAnswer(0), MenuAnswer(0), MenuAnswer(len(shipyardStock)), MenuAnswer(last-1))
+	if !Shipyard(ui, player) {
+		t.Errorf("did not set out")
+	}
+	if !(player.vision == vision+1 && player.upgrades[visor.id] == 1) {
+		t.Errorf("vision %v after buying the visor", player.vision)
+	}
+	if !(player.steel == 50-visor.steel && player.copper == 40-visor.copper-refillCopper) {
+		t.Errorf("left %v steel %v copper", player.steel, player.copper)
+	}
+	if player.air_left != player.air_capacity {
+		t.Errorf("tank not refilled")
+	}
+	st, cu := visor.price(player)
+	if !(st == 2*visor.steel && cu == 2*visor.copper) {
+		t.Errorf("second visor costs %v, %v", st, cu)
+	}
+
+	// Stray keys don't send the player home
+	ui.Script(MenuAnswer(99), AbortAnswer(), MenuAnswer(last))
+	if Shipyard(ui, player) {
+		t.Errorf("did not head home")
+	}
+	if len(ui.answers) != 0 {
+		t.Errorf("left before reading every answer")
+	}
+}
+
+func TestUpgradeIds(t *testing.T) {
+	ids := make(map[string]bool)
+	for _, u := range shipyardStock {
+		if u.id == "" || ids[u.id] {
+			t.Errorf("%v has id %q", u.name, u.id)
+		}
+		ids[u.id] = true
+	}
+}
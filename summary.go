@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+////////////////////// RUN SUMMARY /////////////////////////
+
+// RunStats tallies what the player did on a derelict.
+type RunStats struct {
+	steel, copper     int // Salvaged
+	repaired, created int
+	turns             int
+	airUsed           float64
+
+	// Working equipment when the player arrived, see Level.Working
+	startWorking, startTotal int
+}
+
+// Start notes the state of the level the player is starting on.
+func (s *RunStats) Start(level *Level) {
+	*s = RunStats{}
+	s.startWorking, s.startTotal = level.Working()
+}
+
+// Working counts the cells that can be damaged, and how many of them aren't.
+func (level *Level) Working() (working, total int) {
+	for i := 0; i < level.x; i++ {
+		for j := 0; j < level.y; j++ {
+			if d, ok := level.cells[i][j].(Damageable); ok {
+				total++
+				if !d.Damaged() {
+					working++
+				}
+			}
+		}
+	}
+	return
+}
+
+// Score rewards salvage, repairs and leaving the ship in better shape than it
+// was found, and takes a little off for the time and air it took.
+func (s *RunStats) Score(level *Level) int {
+	working, total := level.Working()
+	score := s.steel + 2*s.copper + 25*s.repaired + 10*s.created -
+		s.turns/10 - int(5*s.airUsed)
+	if total > 0 {
+		score += 500 * (working - s.startWorking) / total
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score
+}
+
+func (s *RunStats) Lines(level *Level) []string {
+	working, total := level.Working()
+	return []string{
+		fmt.Sprintf("Steel salvaged:   %v", s.steel),
+		fmt.Sprintf("Copper salvaged:  %v", s.copper),
+		fmt.Sprintf("Cells repaired:   %v", s.repaired),
+		fmt.Sprintf("Cells created:    %v", s.created),
+		fmt.Sprintf("Turns taken:      %v", s.turns),
+		fmt.Sprintf("Air used:         %.2f", s.airUsed),
+		fmt.Sprintf("Working order:    %v/%v, was %v/%v", working, total, s.startWorking, s.startTotal),
+		"",
+		fmt.Sprintf("Score:            %v", s.Score(level)),
+	}
+}
+
+////////////////////// HIGH SCORES /////////////////////////
+
+// The high score file has one "score seed date" line per run
+var scoreFilename string
+
+const highScoresShown = 5
+
+type HighScore struct {
+	score int
+	seed  int64
+	date  string
+}
+
+func readScores(filename string) ([]HighScore, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var scores []HighScore
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var hs HighScore
+		if _, err := fmt.Sscan(scanner.Text(), &hs.score, &hs.seed, &hs.date); err == nil {
+			scores = append(scores, hs)
+		}
+	}
+	return scores, scanner.Err()
+}
+
+// RecordScore appends a score to the file, returning every score in it from
+// best to worst.
+func RecordScore(filename string, hs HighScore) ([]HighScore, error) {
+	scores, err := readScores(filename)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fmt.Fprintf(file, "%v %v %v\n", hs.score, hs.seed, hs.date); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	scores = append(scores, hs)
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	return scores, nil
+}
+
+// EndOfRun records the score of a player who has left the derelict, in the
+// high score file and their career, and returns the report to show them.
+func EndOfRun(level *Level, player *Player) []string {
+	lines := player.stats.Lines(level)
+	score := player.stats.Score(level)
+	player.recordRun(score)
+	hs := HighScore{score, level.rng.seed, time.Now().Format("2006-01-02")}
+	scores, err := RecordScore(scoreFilename, hs)
+	if err != nil {
+		return append(lines, "", "Could not record score: "+err.Error())
+	}
+	lines = append(lines, "", "High scores:")
+	for i := 0; i < len(scores) && i < highScoresShown; i++ {
+		lines = append(lines, fmt.Sprintf("%2v. %6v  %v  seed %v",
+			i+1, scores[i].score, scores[i].date, scores[i].seed))
+	}
+	return lines
+}
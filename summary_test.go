@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	level, player, ui := testBench(&Wall{damaged: true}, DirectionAnswer(1, 0))
+	player.stats.Start(level)
+	if !(player.stats.startWorking == 0 && player.stats.startTotal == 1) {
+		t.Errorf("started with %v/%v working", player.stats.startWorking, player.stats.startTotal)
+	}
+	before := player.stats.Score(level)
+	act(level, player, ui, REPAIR)
+	if player.stats.repaired != 1 {
+		t.Errorf("counted %v repairs", player.stats.repaired)
+	}
+	if player.stats.Score(level) <= before {
+		t.Errorf("repairing did not raise the score")
+	}
+
+	steel := player.steel
+	ui.Script(DirectionAnswer(1, 0))
+	act(level, player, ui, SALVAGE)
+	if player.stats.steel != player.steel-steel {
+		t.Errorf("counted %v steel of %v", player.stats.steel, player.steel-steel)
+	}
+
+	// Scores come back best first including the new one
+	file, err := os.CreateTemp("", "derelict-scores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	for _, score := range []int{10, 30, 20} {
+		RecordScore(file.Name(), HighScore{score, 1, "today"})
+	}
+	scores, err := readScores(file.Name())
+	if !(err == nil && len(scores) == 3) {
+		t.Errorf("read back %v scores: %v", len(scores), err)
+	}
+	scores, _ = RecordScore(file.Name(), HighScore{25, 2, "today"})
+	if !(len(scores) == 4 && scores[0].score == 30 && scores[1].score == 25 && scores[1].seed == 2) {
+		t.Errorf("scores out of order %v", scores)
+	}
+}
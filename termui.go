@@ -0,0 +1,680 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+type UI interface {
+	Run()                              // Play the current level until the player leaves, dies or quits
+	SetLevel(*Level)                   // Move on to a new level, forgetting the last
+	Close()                            // Done with the UI for good
+	Message(string)                    // Info, see Notify
+	Notify(int, string)                // Message in a category, e.g. dangerMessage
+	Menu(string, []string) (int, bool) // option, aborted
+	DirectionPrompt() (int, int, bool) // x, y, abort
+	YesNoPrompt(string) (bool, bool)   // Yes/No, aborted
+	Report(string, []string)           // Title, lines, shown until dismissed
+}
+
+const (
+	none = iota
+	revealMap
+	airOverlay
+	energyOverlay
+	maxDebugMode
+)
+
+//////////////////// TERMINALS ////////////////////
+
+// A Terminal is the screen and keyboard the TermUI plays on. Key codes are
+// plain characters or the curses codes for the other keys, see keymap.go.
+type Terminal interface {
+	Start() (colour bool)               // Take over the terminal, reporting whether it has colours
+	Stop()                              // Give it back as it was
+	Size() (width, height int)          // In characters
+	Put(x, y int, ch int32, st Style)   // Draw ch at column x, row y
+	Print(x, y int, s string, st Style) // Draw s from x, y along the row
+	Clear()
+	Key() int // Show what has been drawn and wait for a key, keyResize if the size changed
+}
+
+// terminals holds the backends built into the binary, by the name the -ui
+// flag selects them with. Each registers itself in an init function.
+var terminals = make(map[string]func() (Terminal, error))
+
+func terminalNames() []string {
+	var names []string
+	for name := range terminals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultTerminal is curses if it was built in
+func defaultTerminal() string {
+	if _, ok := terminals["curses"]; ok {
+		return "curses"
+	}
+	return "ansi"
+}
+
+// TermUI plays the game on a Terminal
+type TermUI struct {
+	term     Terminal
+	started  bool
+	hungUp   bool // The terminal has gone, see getch
+	mapCache [][]int32
+	styles   [][]Style // Of each cell in mapCache
+	seen     [][]bool
+	readings [][]Reading // What the player noted about each cell seen
+	visible  [][]bool    // In view now, the rest of what was seen is remembered
+	log      MessageLog
+	colour   bool // The terminal has colours
+
+	level  *Level
+	player *Player
+
+	debugMode int
+
+	lookMode     bool
+	lookX, lookY int
+
+	width, height int // Of the terminal
+	viewX, viewY  int // Level coordinates at the top left of the map view
+}
+
+func NewTermUI(term Terminal, level *Level, player *Player) *TermUI {
+	ui := new(TermUI)
+	ui.term = term
+	ui.player = player
+	ui.debugMode = none
+	ui.SetLevel(level)
+	return ui
+}
+func (ui *TermUI) SetLevel(level *Level) {
+	ui.level = level
+	ui.lookMode = false
+
+	// Init the mapCache to store seen parts of the level
+	ui.mapCache = make([][]int32, level.x, level.x)
+	ui.styles = make([][]Style, level.x, level.x)
+	ui.seen = make([][]bool, level.x, level.x)
+	ui.readings = make([][]Reading, level.x, level.x)
+	ui.visible = make([][]bool, level.x, level.x)
+	for i := 0; i < level.x; i++ {
+		ui.mapCache[i] = make([]int32, level.y, level.y)
+		ui.styles[i] = make([]Style, level.y, level.y)
+		ui.seen[i] = make([]bool, level.y, level.y)
+		ui.readings[i] = make([]Reading, level.y, level.y)
+		ui.visible[i] = make([]bool, level.y, level.y)
+		for j := 0; j < level.y; j++ {
+			ui.mapCache[i][j] = ' '
+		}
+	}
+}
+
+// Memory is what the player remembers of the level, as saved with the game
+type Memory struct {
+	mapCache [][]int32
+	seen     [][]bool
+	readings [][]Reading // Only what was measured is kept, nil for none
+}
+
+func (ui *TermUI) memory() Memory { return Memory{ui.mapCache, ui.seen, ui.readings} }
+
+// restoreMemory replaces what the player has seen, e.g. from a saved game.
+// Only the characters are saved, the cells they show give back the styles
+// and what can be told by looking. So until they are seen again the exit,
+// drawn like a floor, comes back as plain floor and live conduits come back
+// unlit.
+func (ui *TermUI) restoreMemory(m Memory) {
+	ui.mapCache, ui.seen = m.mapCache, m.seen
+	for i := range m.mapCache {
+		for j, ch := range m.mapCache[i] {
+			if c, ok := cellFromGlyph(ch); ok {
+				ui.styles[i][j] = c.(Drawable).Style()
+				if !m.seen[i][j] {
+					continue
+				}
+				r := noteCell(c)
+				if m.readings != nil {
+					saved := m.readings[i][j]
+					r.measured, r.air, r.energy, r.turn = saved.measured, saved.air, saved.energy, saved.turn
+					r.damaged = r.damageable && saved.damaged
+				}
+				ui.readings[i][j] = r
+			}
+		}
+	}
+}
+func (ui *TermUI) Run() {
+	if !ui.started {
+		ui.colour = ui.term.Start()
+		ui.started = true
+		ui.resize()
+	}
+	ui.term.Clear()
+	ui.drawMap()
+	moved, quit := 0, false
+	for !quit {
+		// If any messages were added to the stack, draw them now
+		if len(ui.log.Unread()) > 0 {
+			ui.drawMessages()
+		}
+		moved, quit = ui.handleKey(ui.getch())
+		Dlog.Println("   TermUI.Run: ", moved, quit)
+		if quit && ui.hungUp {
+			return
+		}
+		if quit {
+			ui.refresh()
+			ui.Message("Quit")
+			ui.drawMessages()
+			ui.getch()
+			return
+		}
+		for it := 0; it < moved; it++ {
+			if ui.turn() {
+				return
+			}
+			if ui.player.left_ship && ui.level.exit_x == ui.player.x && ui.level.exit_y == ui.player.y {
+				ui.refresh()
+				yes, _ := ui.YesNoPrompt("Leave this derelict behind?")
+				if yes {
+					ui.player.escaped = true
+					ui.Report("You leave the derelict behind", EndOfRun(ui.level, ui.player))
+					return
+				}
+			}
+		}
+		for ui.player.Working() {
+			before := ui.player.Watch(ui.level)
+			if ui.turn() {
+				return
+			}
+			ui.drawMap()
+			ui.refresh()
+			ui.player.Work(ui.level, ui, before)
+		}
+		ui.drawMap()
+		ui.refresh()
+	}
+}
+
+// turn moves the level and player on a turn, returning true if the player
+// died.
+func (ui *TermUI) turn() bool {
+	sensor := ui.player.sensor
+	ui.level.Iterate()
+	ui.player.Iterate(ui.level)
+	tellEvents(ui, ui.level, ui.player)
+	if sensor != noSensor && ui.player.sensor == noSensor {
+		ui.Notify(dangerMessage, "Your suit is out of power, the sensor shuts off")
+	}
+	if ui.player.dead {
+		ui.refresh()
+		ui.Notify(dangerMessage, "You die")
+		ui.drawMessages()
+		ui.getch()
+		return true
+	}
+	return false
+}
+func (ui *TermUI) Close() {
+	if ui.started {
+		ui.term.Stop()
+		ui.started = false
+	}
+}
+func (ui *TermUI) Message(s string) { ui.Notify(infoMessage, s) }
+func (ui *TermUI) Notify(kind int, s string) {
+	ui.log.Add(ui.player.stats.turns, kind, s)
+}
+func (ui *TermUI) Menu(title string, s []string) (option int, aborted bool) {
+	var (
+		idx     int32 = 'a'
+		max_len int   = len(title)
+	)
+	for i := 0; i < len(s); i++ {
+		if len(s[i]) > max_len {
+			max_len = len(s[i])
+		}
+	}
+	max_len += 4 // 3 for "x: " 1 for the space after
+
+	// All the i+1 below are due to the title line offset
+	ui.term.Print(0, 0, title, Style{})
+	for i := 0; i < len(s); i++ {
+		if s[i] == "-" {
+			ui.term.Print(0, i+1, "  -------- ", Style{})
+			ui.term.Print(11, i+1, strings.Repeat(" ", max_len-11), Style{})
+		} else {
+			ui.term.Put(0, i+1, idx, Style{})
+			ui.term.Print(1, i+1, ": ", Style{})
+			ui.term.Print(3, i+1, s[i], Style{})
+			ui.term.Print(3+len(s[i]), i+1, strings.Repeat(" ", max_len-(3+len(s[i]))), Style{})
+			idx++
+		}
+	}
+	ui.term.Print(0, len(s)+1, strings.Repeat(" ", max_len), Style{})
+	option = ui.getch() - 'a'
+	if option < 0 || option >= int(idx-'a') {
+		aborted = true
+	} else {
+		aborted = false
+	}
+	// Interactive elements can call refresh to clear the screen
+	ui.refresh()
+	return
+}
+func (ui *TermUI) Report(title string, lines []string) {
+	ui.term.Clear()
+	ui.term.Print(0, 0, title, Style{})
+	for i, line := range lines {
+		ui.term.Print(2, i+2, line, Style{})
+	}
+	ui.term.Print(0, len(lines)+3, "Press any key", Style{})
+	ui.getch()
+	ui.term.Clear()
+	ui.refresh()
+}
+
+// drawMessages shows the messages not yet seen in the message area, most
+// recent first, pointing to the log if there are too many to fit.
+func (ui *TermUI) drawMessages() {
+	Dlog.Println("-> drawMessages")
+	ui.clearMessages()
+	unread := ui.log.Unread()
+	rows := messageRows
+	if len(unread) > messageRows {
+		rows--
+		ui.term.Print(0, rows, ui.fit(fmt.Sprintf("... %v more, L for the message log", len(unread)-rows)), Style{})
+	}
+	for i := 0; i < rows && i < len(unread); i++ {
+		e := &unread[len(unread)-1-i]
+		Dlog.Println("   drawMessages:", e.String())
+		ui.term.Print(0, i, ui.fit(e.String()), messageStyle(e.kind))
+	}
+	ui.log.MarkRead()
+	Dlog.Println("<- drawMessages")
+}
+
+// overlayDigit shows a reading as a digit where there are no colours
+func overlayDigit(v float64) int32 {
+	if v >= 10 {
+		return '9'
+	}
+	return '0' + int32(v)
+}
+
+// showLog pages through the message log, any key but those scrolling it
+// goes back to the game.
+func (ui *TermUI) showLog() {
+	entries := ui.log.Entries()
+	top := len(entries)
+	for {
+		rows := ui.height - 3 // Title, gap and footer
+		if rows < 1 {
+			rows = 1
+		}
+		if top > len(entries)-rows {
+			top = len(entries) - rows
+		}
+		if top < 0 {
+			top = 0
+		}
+		ui.term.Clear()
+		ui.term.Print(0, 0, ui.fit(" Turn  Message log"), Style{bold: true})
+		for i := 0; i < rows && top+i < len(entries); i++ {
+			e := &entries[top+i]
+			ui.term.Print(0, i+2, ui.fit(fmt.Sprintf("%5v  %v", e.turn, e.String())), messageStyle(e.kind))
+		}
+		ui.term.Print(0, ui.height-1, ui.fit("j/k scroll, space/b page, any other key to return"), Style{})
+		switch ui.getch() {
+		case 'k', keyUp:
+			top--
+		case 'j', keyDown:
+			top++
+		case 'b', keyPPage:
+			top -= rows
+		case ' ', keyNPage:
+			top += rows
+		default:
+			ui.term.Clear()
+			ui.refresh()
+			return
+		}
+	}
+}
+func (ui *TermUI) clearMessages() {
+	for i := 0; i < messageRows; i++ {
+		ui.term.Print(0, i, strings.Repeat(" ", ui.width-1), Style{})
+	}
+}
+
+// fit cuts s to fit on a line of the screen.
+func (ui *TermUI) fit(s string) string {
+	if len(s) >= ui.width {
+		return s[:ui.width-1]
+	}
+	return s
+}
+
+//////////////////// SCREEN LAYOUT ////////////////////
+
+// The screen has the message area at the top, the status line at the bottom
+// and a view of the map between them that scrolls to follow the player.
+const (
+	messageRows = 2
+	statusRows  = 1
+	viewMargin  = 5 // Scroll before the player gets closer than this to the edge
+)
+
+// getch waits for a key. When the terminal goes the game is given the
+// keyHangup to quit on, if it asks for another key anyway it is stuck in
+// some menu and there's nothing to do but stop.
+func (ui *TermUI) getch() int {
+	for {
+		key := ui.term.Key()
+		if key == keyHangup && ui.hungUp {
+			ui.Close()
+			log.Fatal("The terminal has gone")
+		}
+		if key == keyHangup {
+			ui.hungUp = true
+			return key
+		}
+		if key != keyResize {
+			return key
+		}
+		ui.resize()
+		ui.refresh()
+	}
+}
+
+// resize fits the layout to the terminal, on start up and when it changes.
+func (ui *TermUI) resize() {
+	ui.width, ui.height = ui.term.Size()
+	if ui.width < 2 {
+		ui.width = 2
+	}
+	Dlog.Println("   TermUI.resize:", ui.width, ui.height)
+	ui.term.Clear()
+}
+func (ui *TermUI) viewRows() int {
+	if rows := ui.height - messageRows - statusRows; rows > 1 {
+		return rows
+	}
+	return 1
+}
+
+// follow scrolls the view so that x, y is in it, clear of the edges.
+func (ui *TermUI) follow(x, y int) {
+	ui.viewX = scroll(ui.viewX, x, ui.width, ui.level.x)
+	ui.viewY = scroll(ui.viewY, y, ui.viewRows(), ui.level.y)
+}
+
+// scroll returns where a view size long should start over a level length
+// long, moving it from start as little as needed to keep pos margin from its
+// edges.
+func scroll(start, pos, size, length int) int {
+	if length <= size {
+		return 0
+	}
+	margin := viewMargin
+	if 2*margin >= size {
+		margin = (size - 1) / 2
+	}
+	if pos < start+margin {
+		start = pos - margin
+	}
+	if pos >= start+size-margin {
+		start = pos - size + margin + 1
+	}
+	if start > length-size {
+		start = length - size
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start
+}
+
+// put draws ch at x, y on the level if it is in view.
+func (ui *TermUI) put(x, y int, ch int32, st Style) {
+	sx, sy := x-ui.viewX, y-ui.viewY
+	if sx >= 0 && sx < ui.width && sy >= 0 && sy < ui.viewRows() {
+		ui.term.Put(sx, messageRows+sy, ch, st)
+	}
+}
+func (ui *TermUI) YesNoPrompt(message string) (result, aborted bool) {
+	ui.term.Print(0, 0, message, Style{})
+	ui.term.Print(len(message), 0, " Y/N ", Style{})
+	ch := ui.getch()
+	if ch == 'y' || ch == 'Y' {
+		return true, false
+	} else if ch == 'n' || ch == 'N' {
+		return false, false
+	}
+	return false, true
+}
+func (ui *TermUI) drawSensor(rng int, sensed [][]float64) {
+	x, y := ui.player.x, ui.player.y
+	for i := -rng; i < rng; i++ {
+		for j := -rng; j < rng; j++ {
+			if i*i+j*j < rng*rng {
+				if x+i >= 0 && x+i < ui.level.x && y+j >= 0 && y+j < ui.level.y {
+					if ui.colour {
+						ui.put(x+i, y+j, ui.mapCache[x+i][y+j], overlayStyle(sensed[x+i][y+j]))
+					} else {
+						ui.put(x+i, y+j, overlayDigit(sensed[x+i][y+j]), Style{})
+					}
+				}
+			}
+		}
+	}
+}
+
+func (ui *TermUI) refresh() {
+	if ui.lookMode {
+		ui.follow(ui.lookX, ui.lookY)
+	} else {
+		ui.follow(ui.player.x, ui.player.y)
+	}
+	ui.clearMessages()
+
+	var ch int32
+	var st Style
+	for sx := 0; sx < ui.width; sx++ {
+		for sy := 0; sy < ui.viewRows(); sy++ {
+			i, j := ui.viewX+sx, ui.viewY+sy
+			if i >= ui.level.x || j >= ui.level.y {
+				ui.term.Put(sx, messageRows+sy, ' ', Style{})
+				continue
+			}
+			switch ui.debugMode {
+			case none:
+				ch, st = ui.mapCache[i][j], ui.styles[i][j]
+				if ui.seen[i][j] && !ui.visible[i][j] {
+					st.dim = true
+				} else if ui.readings[i][j].Changed(ui.player.stats.turns) {
+					st.reverse = true
+				}
+			case revealMap:
+				ch, st = ui.level.cells[i][j].(Drawable).Character(), ui.level.StyleAt(i, j)
+			case airOverlay, energyOverlay:
+				v := ui.level.air.air[i][j]
+				if ui.debugMode == energyOverlay {
+					v = ui.level.energy.energy[i][j]
+				}
+				if ui.colour {
+					ch, st = ui.level.cells[i][j].(Drawable).Character(), overlayStyle(v)
+				} else {
+					ch, st = overlayDigit(v), Style{}
+				}
+			}
+			ui.term.Put(sx, messageRows+sy, ch, st)
+		}
+	}
+
+	// Draw player and sensor information if any
+	switch ui.player.sensor {
+	case noSensor:
+		ui.put(ui.player.x, ui.player.y, ui.player.Character(), playerStyle)
+	case pressureSensor:
+		ui.drawSensor(ui.player.pressure_sensor_range, ui.level.air.air)
+	case energySensor:
+		ui.drawSensor(ui.player.energy_sensor_range, ui.level.energy.energy)
+	}
+	// Looking?
+	if ui.lookMode {
+		Dlog.Println("   refresh: lookMode")
+		if ui.player.x == ui.lookX && ui.player.y == ui.lookY {
+			ui.put(ui.lookX, ui.lookY, ui.player.Character(), Style{reverse: true})
+		} else {
+			st := ui.styles[ui.lookX][ui.lookY]
+			st.reverse = true
+			ui.put(ui.lookX, ui.lookY, ui.mapCache[ui.lookX][ui.lookY], st)
+		}
+		ui.drawInspect()
+	}
+	ui.drawModeLine()
+}
+
+func (ui *TermUI) drawMap() {
+	Dlog.Println("-> TermUI.drawMap")
+	wasVisible := ui.visible
+	ui.visible = make([][]bool, ui.level.x)
+	for i := range ui.visible {
+		ui.visible[i] = make([]bool, ui.level.y)
+	}
+	FieldOfView(ui.level.cells, ui.player.x, ui.player.y, ui.player.vision, func(x, y int) {
+		ui.see(x, y, wasVisible[x][y])
+	})
+	ui.refresh()
+	Dlog.Println("<- TermUI.drawMap")
+}
+func (ui *TermUI) drawModeLine() {
+	var sensors string = "  "
+	switch ui.player.sensor {
+	case pressureSensor:
+		sensors = "p"
+	case energySensor:
+		sensors = "e"
+	}
+	helmet := "off"
+	if ui.player.helmet_on {
+		helmet = "on"
+	}
+	line := fmt.Sprintf("-- deReLict --  St:%v Cu:%v Air:%4.2f/%4.2f En:%4.2f/%4.2f Helmet:%v, Sensor:%v",
+		ui.player.steel, ui.player.copper, ui.player.air_left,
+		ui.player.air_capacity, ui.player.energy_left,
+		ui.player.energy_capcacity, helmet, sensors)
+	if ui.debugMode == airOverlay {
+		line += fmt.Sprintf(" Atmosphere:%.1f", ui.level.Atmosphere())
+	}
+	line = ui.fit(line)
+	ui.term.Print(0, ui.height-statusRows, line+strings.Repeat(" ", ui.width-1-len(line)), Style{})
+}
+
+// keyToDir gives the direction a key is bound to, or abort if it is not a move
+func keyToDir(key int) (int, int, bool) { // dx,dy,abort
+	command := keymap[key]
+	if !isMove(command) {
+		return 0, 0, true
+	}
+	return commandInfo[command].dx, commandInfo[command].dy, false
+}
+
+func (ui *TermUI) DirectionPrompt() (x, y int, abort bool) {
+	ui.term.Print(0, 0, "Which Direction?", Style{})
+	x, y, abort = keyToDir(ui.getch())
+	ui.refresh()
+	return
+}
+func (ui *TermUI) handleKey(key int) (moved int, quit bool) {
+	Dlog.Printf("-> handleKey key: %c", key)
+	moved, quit = 0, false
+	if key == keyHangup {
+		return 0, true
+	}
+	x, y, abort := keyToDir(key)
+	if !abort {
+		if ui.lookMode {
+			if ui.lookX+x >= 0 && ui.lookX+x < ui.level.x &&
+				ui.lookY+y >= 0 && ui.lookY+y < ui.level.y {
+				ui.lookX += x
+				ui.lookY += y
+			}
+		} else if ui.player.Walk(x, y, ui.level) {
+			moved = 1
+		}
+	} else {
+		switch keymap[key] {
+		case actionMenu:
+			moved = ui.act(NONE)
+		case createCommand:
+			moved = ui.act(CREATE)
+		case repairCommand:
+			moved = ui.act(REPAIR)
+		case salvageCommand:
+			moved = ui.act(SALVAGE)
+		case activateCommand:
+			moved = ui.act(ACTIVATE)
+		case pressureCommand: // Toggle Pressure Sensor
+			if ui.player.sensor == pressureSensor {
+				ui.player.sensor = noSensor
+			} else if ui.player.energy_left <= 0 {
+				ui.Message("Your suit has no power for the sensor")
+			} else {
+				ui.player.sensor = pressureSensor
+			}
+			ui.refresh()
+		case energyCommand: // Toggle Energy Sensor
+			if ui.player.sensor == energySensor {
+				ui.player.sensor = noSensor
+			} else if ui.player.energy_left <= 0 {
+				ui.Message("Your suit has no power for the sensor")
+			} else {
+				ui.player.sensor = energySensor
+			}
+			ui.refresh()
+		case helmetCommand:
+			ui.Message(ui.player.ToggleHelmet())
+			moved = 1
+		case lookCommand: // Toggle look mode
+			ui.lookMode = !ui.lookMode
+			if ui.lookMode {
+				ui.lookX = ui.player.x
+				ui.lookY = ui.player.y
+				ui.Message("Looking around - this is you")
+			}
+		case logCommand:
+			ui.showLog()
+		case debugCommand:
+			ui.debugMode++
+			if ui.debugMode == maxDebugMode {
+				ui.debugMode = none
+			}
+		case helpCommand:
+			ui.Report("Keys", keymap.Help())
+		case quitCommand:
+			quit = true
+			save, aborted := ui.YesNoPrompt("Save before quitting?")
+			if !aborted && save {
+				if err := SaveGameFile(saveFilename, ui.level, ui.player, ui.memory()); err != nil {
+					ui.Notify(dangerMessage, "Could not save: "+err.Error())
+					quit = false // Rather than lose the game
+				} else {
+					ui.Notify(successMessage, "Game saved to "+saveFilename)
+				}
+			}
+		}
+	}
+	Dlog.Printf("<- handleKey moved: %v, quit: %v", moved, quit)
+	return
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestView(t *testing.T) {
+	views := []struct{ start, pos, size, length, want int }{
+		{0, 10, 80, 69, 0},     // Level fits
+		{0, 10, 40, 200, 0},    // Clear of the edge
+		{0, 37, 40, 200, 3},    // Scrolls right to keep the margin
+		{50, 52, 40, 200, 47},  // And back left
+		{0, 199, 40, 200, 160}, // But not past the end
+		{0, 0, 3, 200, 0},      // Tiny view
+		{0, 5, 3, 200, 4},
+	}
+	for _, v := range views {
+		got := scroll(v.start, v.pos, v.size, v.length)
+		if got != v.want {
+			t.Errorf("scroll(%v, %v, %v, %v) = %v not %v", v.start, v.pos, v.size, v.length, got, v.want)
+		}
+	}
+}
+
+// scriptTerminal is a Terminal that plays back keys, then hangs up
+type scriptTerminal struct {
+	keys  []int
+	reads int
+}
+
+func (t *scriptTerminal) Start() bool                        { return false }
+func (t *scriptTerminal) Stop()                              {}
+func (t *scriptTerminal) Size() (int, int)                   { return 80, 24 }
+func (t *scriptTerminal) Put(x, y int, ch int32, st Style)   {}
+func (t *scriptTerminal) Print(x, y int, s string, st Style) {}
+func (t *scriptTerminal) Clear()                             {}
+func (t *scriptTerminal) Key() int {
+	t.reads++
+	if len(t.keys) == 0 {
+		return keyHangup
+	}
+	key := t.keys[0]
+	t.keys = t.keys[1:]
+	return key
+}
+
+func TestHangup(t *testing.T) {
+	// Quits when the terminal goes even with q unbound
+	saved := keymap
+	defer func() { keymap = saved }()
+	keymap = DefaultKeymap()
+	delete(keymap, 'q')
+	level, player, _ := testBench(new(Floor))
+	term := &scriptTerminal{keys: []int{'q', 'l'}}
+	NewTermUI(term, level, player).Run()
+	if term.reads != 3 || player.x != 1 {
+		t.Errorf("read %v keys and moved to %v", term.reads, player.x)
+	}
+}
+
+func TestSaveFails(t *testing.T) {
+	// Keeps playing if the game cannot be saved on the way out
+	saved := saveFilename
+	defer func() { saveFilename = saved }()
+	saveFilename = t.TempDir() + "/missing/derelict.sav"
+	level, player, _ := testBench(new(Floor))
+	term := &scriptTerminal{keys: []int{'q', 'y', 'l'}}
+	NewTermUI(term, level, player).Run()
+	if player.x != 1 {
+		t.Errorf("quit without saving")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+//////////////////// WEB TERMINAL ////////////////////
+
+// The web backend serves a page that draws the screen on a canvas and sends
+// keys back over a websocket, the game runs in the TermUI as on any other
+// terminal. One browser plays at a time, a new one takes over and closing
+// the page just waits for it to come back.
+
+// Where -ui web listens, localhost only unless told otherwise
+var httpAddr string
+
+func init() {
+	terminals["web"] = func() (Terminal, error) { return NewWebTerminal(httpAddr) }
+}
+
+// Limits on the size a browser asks for
+const (
+	minWebWidth, minWebHeight = 20, 5
+	maxWebWidth, maxWebHeight = 500, 200
+)
+
+// A webEvent is something from a browser: a connection, a key, a size or
+// hanging up.
+type webEvent struct {
+	conn          *wsConn
+	opened        bool
+	closed        bool
+	key           int
+	width, height int
+}
+
+// webUpdate is sent to the browser, each cell is x, y, character, fg, bg
+// and attributes (1 bold, 2 dim, 4 reverse).
+type webUpdate struct {
+	Cells [][6]int `json:"cells,omitempty"`
+	Bye   bool     `json:"bye,omitempty"`
+}
+
+type WebTerminal struct {
+	screenBuffer
+	listener net.Listener
+	events   chan webEvent
+	conn     *wsConn // The browser playing, nil while there is none
+}
+
+// NewWebTerminal listens on addr, so that it is known to be free before the
+// game starts.
+func NewWebTerminal(addr string) (*WebTerminal, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &WebTerminal{listener: listener, events: make(chan webEvent, 64)}, nil
+}
+
+// Start serves the front end and waits for a browser to connect.
+func (t *WebTerminal) Start() bool {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, webPage)
+	})
+	mux.HandleFunc("/ws", t.serveWebsocket)
+	go http.Serve(t.listener, mux)
+	fmt.Printf("Open http://%v/ in a browser to play\n", t.listener.Addr())
+
+	for t.conn == nil || t.width == 0 {
+		t.handle(<-t.events)
+	}
+	return true
+}
+
+func (t *WebTerminal) Stop() {
+	if t.conn != nil {
+		t.flush()
+		t.send(webUpdate{Bye: true})
+		t.conn.Close()
+	}
+	t.listener.Close()
+}
+
+// serveWebsocket passes on everything a browser says as events for Key
+func (t *WebTerminal) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		Dlog.Println("   WebTerminal:", err)
+		return
+	}
+	t.events <- webEvent{conn: conn, opened: true}
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			t.events <- webEvent{conn: conn, closed: true}
+			return
+		}
+		e := webEvent{conn: conn}
+		if n, _ := fmt.Sscanf(message, "k %d", &e.key); n == 1 {
+			t.events <- e
+		} else if n, _ := fmt.Sscanf(message, "s %d %d", &e.width, &e.height); n == 2 {
+			t.events <- e
+		}
+	}
+}
+
+// handle acts on an event, returning the key it was if any, or keyResize.
+func (t *WebTerminal) handle(e webEvent) int {
+	switch {
+	case e.opened:
+		if t.conn != nil {
+			t.conn.Close()
+		}
+		t.conn = e.conn
+		t.invalidate()
+	case e.conn != t.conn:
+		// From a browser that has been replaced
+	case e.closed:
+		t.conn = nil
+	case e.width > 0 || e.height > 0:
+		width, height := clamp(e.width, minWebWidth, maxWebWidth), clamp(e.height, minWebHeight, maxWebHeight)
+		t.resize(width, height)
+		return keyResize
+	default:
+		return e.key
+	}
+	return 0
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func (t *WebTerminal) Key() int {
+	t.flush()
+	for {
+		if key := t.handle(<-t.events); key != 0 {
+			return key
+		}
+		t.flush()
+	}
+}
+
+// flush sends the browser the cells that have changed
+func (t *WebTerminal) flush() {
+	if t.conn == nil {
+		return
+	}
+	var u webUpdate
+	t.changes(func(x, y int, c screenCell) {
+		attr := 0
+		if c.st.bold {
+			attr |= 1
+		}
+		if c.st.dim {
+			attr |= 2
+		}
+		if c.st.reverse {
+			attr |= 4
+		}
+		u.Cells = append(u.Cells, [6]int{x, y, int(c.ch), int(c.st.fg), int(c.st.bg), attr})
+	})
+	if len(u.Cells) > 0 {
+		t.send(u)
+	}
+}
+
+func (t *WebTerminal) send(u webUpdate) {
+	message, _ := json.Marshal(u)
+	if err := t.conn.WriteMessage(string(message)); err != nil {
+		Dlog.Println("   WebTerminal.send:", err)
+		t.conn.conn.Close()
+		t.conn = nil
+	}
+}
+
+// webPage is the whole front end. It sizes the screen to the window and
+// turns keys into the codes the keymap uses, see keymap.go.
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>deReLict</title>
+<style>
+html, body { margin: 0; height: 100%; background: #000; overflow: hidden; }
+canvas { display: block; }
+#status { position: fixed; right: 0; bottom: 0; padding: 2px 6px; color: #888; font: 12px monospace; }
+</style>
+</head>
+<body>
+<canvas id="screen"></canvas>
+<div id="status">Connecting</div>
+<script>
+"use strict";
+const fontSize = 16, font = fontSize + "px monospace";
+// Colours 1 to 8 as the game numbers them, normal and bold
+const colours = ["#000", "#c00", "#0c0", "#cc0", "#00c", "#c0c", "#0cc", "#ccc"];
+const bright = ["#555", "#f55", "#5f5", "#ff5", "#55f", "#f5f", "#5ff", "#fff"];
+const keys = {
+	ArrowUp: 259, ArrowDown: 258, ArrowLeft: 260, ArrowRight: 261,
+	Home: 262, End: 360, PageUp: 339, PageDown: 338, Clear: 350,
+	Escape: 27, Enter: 10, Tab: 9, Backspace: 8,
+};
+const canvas = document.getElementById("screen"), ctx = canvas.getContext("2d");
+const status = document.getElementById("status");
+let cw = 0, ch = 0, ws = null;
+
+function fit() {
+	canvas.width = window.innerWidth;
+	canvas.height = window.innerHeight;
+	ctx.font = font;
+	cw = Math.ceil(ctx.measureText("M").width);
+	ch = Math.ceil(fontSize * 1.25);
+	ctx.fillStyle = "#000";
+	ctx.fillRect(0, 0, canvas.width, canvas.height);
+	return [Math.floor(canvas.width / cw), Math.floor(canvas.height / ch)];
+}
+
+function draw(x, y, code, fg, bg, attr) {
+	let f = fg ? (attr & 1 ? bright : colours)[fg - 1] : (attr & 1 ? "#fff" : "#ccc");
+	let b = bg ? colours[bg - 1] : "#000";
+	if (attr & 4) {
+		[f, b] = [b, f];
+	}
+	ctx.globalAlpha = 1;
+	ctx.fillStyle = b;
+	ctx.fillRect(x * cw, y * ch, cw, ch);
+	ctx.globalAlpha = attr & 2 ? 0.5 : 1;
+	ctx.fillStyle = f;
+	ctx.font = (attr & 1 ? "bold " : "") + font;
+	ctx.textBaseline = "middle";
+	ctx.fillText(String.fromCodePoint(code), x * cw, y * ch + ch / 2);
+}
+
+function sendSize() {
+	const [cols, rows] = fit();
+	ws.send("s " + cols + " " + rows);
+}
+
+function connect() {
+	ws = new WebSocket((location.protocol == "https:" ? "wss://" : "ws://") + location.host + "/ws");
+	ws.onopen = () => {
+		status.textContent = "";
+		sendSize();
+	};
+	ws.onmessage = (e) => {
+		const u = JSON.parse(e.data);
+		for (const c of u.cells || []) {
+			draw(...c);
+		}
+		if (u.bye) {
+			ws.onclose = null;
+			status.textContent = "The game is over";
+		}
+	};
+	ws.onclose = () => {
+		status.textContent = "Disconnected, retrying";
+		setTimeout(connect, 1000);
+	};
+}
+
+window.onresize = () => {
+	if (ws && ws.readyState == WebSocket.OPEN) {
+		sendSize();
+	}
+};
+
+document.onkeydown = (e) => {
+	if (e.ctrlKey || e.altKey || e.metaKey) {
+		return;
+	}
+	let code = keys[e.key];
+	if (code === undefined && [...e.key].length == 1) {
+		code = e.key.codePointAt(0);
+	}
+	if (code === undefined) {
+		return;
+	}
+	e.preventDefault();
+	if (ws && ws.readyState == WebSocket.OPEN) {
+		ws.send("k " + code);
+	}
+};
+
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestWeb(t *testing.T) {
+	// The example in RFC 6455
+	accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ==")
+	if accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("accept %v", accept)
+	}
+
+	// A masked message in two frames from the client, with a ping between
+	client, server := net.Pipe()
+	ws := &wsConn{conn: server, r: bufio.NewReader(server)}
+	go func() {
+		mask := []byte{1, 2, 3, 4}
+		frame := func(head byte, text string) {
+			b := []byte{head, 0x80 | byte(len(text))}
+			b = append(b, mask...)
+			for i := range text {
+				b = append(b, text[i]^mask[i%4])
+			}
+			client.Write(b)
+		}
+		frame(wsText, "k 1")
+		frame(0x80|wsPing, "")
+		frame(0x80|wsContinuation, "04")
+	}()
+	pong := make([]byte, 2)
+	go func() { io.ReadFull(client, pong) }()
+	message, err := ws.ReadMessage()
+	if !(err == nil && message == "k 104") {
+		t.Errorf("read %q, %v", message, err)
+	}
+
+	// Only what changed is sent again
+	var b screenBuffer
+	b.resize(3, 2)
+	sent := 0
+	b.changes(func(x, y int, c screenCell) { sent++ })
+	if sent != 6 {
+		t.Errorf("%v cells sent at first", sent)
+	}
+	b.Print(1, 1, "ab", damagedStyle)
+	var cells []screenCell
+	b.changes(func(x, y int, c screenCell) { cells = append(cells, c) })
+	if !(len(cells) == 2 && cells[0] == screenCell{'a', damagedStyle}) {
+		t.Errorf("sent %v", cells)
+	}
+	b.Clear()
+	b.Print(1, 1, "a", damagedStyle)
+	cells = nil
+	b.changes(func(x, y int, c screenCell) { cells = append(cells, c) })
+	if !(len(cells) == 1 && cells[0] == blankCell) {
+		t.Errorf("sent %v", cells)
+	}
+}
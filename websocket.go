@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+//////////////////// WEBSOCKET ////////////////////
+
+// Just enough of RFC 6455 for the browser front end: text messages both ways,
+// pings answered and close. Only the standard library is needed.
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxWSMessage  = 1 << 16 // The client only sends keys and sizes
+
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // Writes come from the game and from answering pings
+}
+
+// websocketAccept is the Sec-WebSocket-Accept answer to a client's key
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// upgradeWebsocket answers a websocket handshake, taking over the connection.
+// Pages from other sites are refused, they have no business playing.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		http.Error(w, "Expected a websocket", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return nil, fmt.Errorf("websocket from origin %q", origin)
+		}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("no websocket key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Cannot take over the connection", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n",
+		websocketAccept(key))
+	if err = rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | opcode, 0} // Always the final frame, servers never mask
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n < 1<<16:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	_, err := c.conn.Write(append(header, payload...))
+	return err
+}
+
+func (c *wsConn) WriteMessage(text string) error { return c.writeFrame(wsText, []byte(text)) }
+
+// readFrame reads one frame, unmasking it
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0f
+	if head[1]&0x80 == 0 {
+		err = errors.New("websocket: unmasked frame from client")
+		return
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxWSMessage {
+		err = fmt.Errorf("websocket: %v byte frame", n)
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. A close from the client is returned as io.EOF.
+func (c *wsConn) ReadMessage() (string, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return "", err
+		}
+		switch opcode {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, nil)
+			return "", io.EOF
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if len(message) > maxWSMessage {
+				return "", errors.New("websocket: message too long")
+			}
+		default:
+			return "", fmt.Errorf("websocket: opcode %v", opcode)
+		}
+		if fin {
+			return string(message), nil
+		}
+	}
+}
+
+// Close says goodbye and hangs up
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, nil)
+	return c.conn.Close()
+}